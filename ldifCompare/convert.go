@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"example.com/ldifCompare/ldif"
+)
+
+/*
+Implements the convert subcommand. Reads the configuration in slapd.d directory or slapd.conf format
+and writes it as ldif in standard output, without operational attributes.
+*/
+func convertMain(args []string) {
+	convertFlags := flag.NewFlagSet("convert", flag.ExitOnError)
+	dirPtr := convertFlags.String("dir", "", "slapd.d directory to convert")
+	confPtr := convertFlags.String("conf", "", "slapd.conf file to convert, using slaptest")
+	slaptestPtr := convertFlags.String("slaptest", ldif.SlaptestCommand, "Path to the slaptest command")
+	convertFlags.Parse(args)
+
+	ldif.SlaptestCommand = *slaptestPtr
+
+	entries, e := readConfig(*dirPtr, *confPtr)
+	if e != nil {
+		fmt.Println("[ERROR] ", e.Error())
+		os.Exit(exitError)
+	}
+	if entries == nil {
+		fmt.Println("[ERROR] either -dir or -conf must be specified")
+		os.Exit(exitError)
+	}
+
+	fmt.Print(entries)
+}
+
+// Reads the configuration from a slapd.d directory or from a slapd.conf file, whichever is specified
+// Returns nil if none is specified
+func readConfig(dir string, conf string) (ldif.EntryList, error) {
+	switch {
+	case dir != "":
+		return ldif.ReadConfigDir(dir)
+	case conf != "":
+		return ldif.ConvertConfigFile(conf)
+	default:
+		return nil, nil
+	}
+}
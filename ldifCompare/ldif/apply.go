@@ -0,0 +1,283 @@
+package ldif
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Apply applies the change records, in order, to a copy of the entries, and returns the result
+// Values are matched using the schema in the options. Attributes whose values all have {n} prefixes
+// follow the X-ORDERED semantics of cn=config: values are added and deleted by index, and the
+// rest of the values are renumbered
+func Apply(entries EntryList, changes []ChangeRecord, options Options) (EntryList, error) {
+	set := newEntrySet(entries)
+	for i, change := range changes {
+		if err := set.apply(change, options.Schema); err != nil {
+			return nil, fmt.Errorf("change %d (%s %s): %w", i+1, change.ChangeType, change.DN, err)
+		}
+	}
+	return set.entries(), nil
+}
+
+// Entries by normalized dn, where the changes are applied
+type entrySet map[string]*Entry
+
+func newEntrySet(entries EntryList) entrySet {
+	set := make(entrySet, len(entries))
+	for _, entry := range entries {
+		set[dnKey(entry.DN)] = copyEntry(entry)
+	}
+	return set
+}
+
+// Returns the entry with the DN, or nil if there is none
+func (set entrySet) lookup(dn string) *Entry {
+	return set[dnKey(dn)]
+}
+
+func (set entrySet) apply(change ChangeRecord, schema *Schema) error {
+	switch change.ChangeType {
+	case ChangeAdd:
+		return applyAdd(set, change)
+	case ChangeDelete:
+		return applyDelete(set, change)
+	case ChangeModify:
+		return applyModify(set, change, schema)
+	case ChangeModRDN:
+		return applyModRDN(set, change, schema)
+	default:
+		return ErrInvalidChangeType
+	}
+}
+
+// Returns the entries, sorted
+func (set entrySet) entries() EntryList {
+	result := make(EntryList, 0, len(set))
+	for _, entry := range set {
+		result = append(result, *entry)
+	}
+	sort.Sort(result)
+	return result
+}
+
+// The key used to look for entries, equal for equivalent DNs
+func dnKey(dn string) string {
+	return strings.Join(dnSortKey(dn), "\x00")
+}
+
+func copyEntry(entry Entry) *Entry {
+	copied := NewEntry(entry.DN)
+	for name, values := range entry.Attributes {
+		copied.Attributes[name] = append([]string{}, values...)
+	}
+	return &copied
+}
+
+func applyAdd(set entrySet, change ChangeRecord) error {
+	key := dnKey(change.DN)
+	if _, found := set[key]; found {
+		return ErrAlreadyExists
+	}
+	set[key] = copyEntry(Entry{DN: change.DN, Attributes: change.Attributes})
+	return nil
+}
+
+func applyDelete(set entrySet, change ChangeRecord) error {
+	key := dnKey(change.DN)
+	if _, found := set[key]; !found {
+		return ErrNoSuchObject
+	}
+	for childKey := range set {
+		if strings.HasPrefix(childKey, key+"\x00") {
+			return ErrNotAllowedOnNonLeaf
+		}
+	}
+	delete(set, key)
+	return nil
+}
+
+func applyModify(set entrySet, change ChangeRecord, schema *Schema) error {
+	entry, found := set[dnKey(change.DN)]
+	if !found {
+		return ErrNoSuchObject
+	}
+
+	// Modifications are applied to a copy, so that the entry is not changed if any of them fails
+	modified := copyEntry(*entry)
+	for _, mod := range change.Modifications {
+		if err := applyModification(modified, mod, schema); err != nil {
+			return fmt.Errorf("%s %s: %w", mod.Type, mod.Attribute, err)
+		}
+	}
+	*entry = *modified
+	return nil
+}
+
+// Returns the name of the attribute in the entry that is equivalent to the specified one, or the
+// specified one if the entry has no such attribute
+func entryAttributeName(entry *Entry, name string, schema *Schema) string {
+	key := schema.AttributeKey(name)
+	for existing := range entry.Attributes {
+		if schema.AttributeKey(existing) == key {
+			return existing
+		}
+	}
+	return name
+}
+
+func applyModification(entry *Entry, mod Modification, schema *Schema) error {
+	name := entryAttributeName(entry, mod.Attribute, schema)
+	values := entry.Attributes[name]
+
+	switch mod.Type {
+	case ModReplace:
+		values = append([]string{}, mod.Values...)
+
+	case ModAdd:
+		for _, value := range mod.Values {
+			if index, bareValue, ok := splitOrderedValue(value); ok && isOrderedAttribute(values, nil) {
+				// Insert in position, moving the following ones
+				bare := sortOrderedValues(values)
+				if index > len(bare) || index < 0 {
+					index = len(bare)
+				}
+				bare = append(bare[:index], append([]string{bareValue}, bare[index:]...)...)
+				values = renumberOrderedValues(bare)
+				continue
+			}
+			if indexOfValue(name, values, value, schema) >= 0 {
+				return ErrValueExists
+			}
+			values = append(values, value)
+		}
+
+	case ModDelete:
+		if len(mod.Values) == 0 {
+			if len(values) == 0 {
+				return ErrNoSuchAttribute
+			}
+			values = nil
+		}
+		for _, value := range mod.Values {
+			if index, _, ok := splitOrderedValue(value); ok && isOrderedAttribute(values, nil) {
+				// Delete by index, moving the following ones
+				bare := sortOrderedValues(values)
+				if index < 0 || index >= len(bare) {
+					return ErrNoSuchAttribute
+				}
+				values = renumberOrderedValues(append(bare[:index], bare[index+1:]...))
+				continue
+			}
+			position := indexOfValue(name, values, value, schema)
+			if position < 0 {
+				return ErrNoSuchAttribute
+			}
+			values = append(values[:position], values[position+1:]...)
+		}
+
+	default:
+		return ErrInvalidModification
+	}
+
+	if len(values) == 0 {
+		delete(entry.Attributes, name)
+	} else {
+		entry.Attributes[name] = values
+	}
+	return nil
+}
+
+// Returns the position of the value in the list, using the equality matching rule of the attribute,
+// or -1 if not found
+func indexOfValue(name string, values []string, value string, schema *Schema) int {
+	normalized := schema.NormalizeValue(name, value)
+	for i, v := range values {
+		if schema.NormalizeValue(name, v) == normalized {
+			return i
+		}
+	}
+	return -1
+}
+
+// Adds the {n} prefixes to the values, in order
+func renumberOrderedValues(bare []string) []string {
+	values := make([]string, len(bare))
+	for i, v := range bare {
+		values[i] = orderedValue(i, v)
+	}
+	return values
+}
+
+func applyModRDN(set entrySet, change ChangeRecord, schema *Schema) error {
+	oldKey := dnKey(change.DN)
+	entry, found := set[oldKey]
+	if !found {
+		return ErrNoSuchObject
+	}
+
+	oldDN, err := ParseDN(change.DN)
+	if err != nil {
+		return err
+	}
+	newRDN, err := ParseDN(change.NewRDN)
+	if err != nil || len(newRDN) != 1 {
+		return fmt.Errorf("%w: invalid newrdn %q", ErrInvalidModification, change.NewRDN)
+	}
+	parent := oldDN.Parent()
+	if change.NewSuperior != "" {
+		if parent, err = ParseDN(change.NewSuperior); err != nil {
+			return err
+		}
+	}
+	newDN := append(DN{newRDN[0]}, parent...)
+	newKey := dnKey(newDN.String())
+	if _, found := set[newKey]; found && newKey != oldKey {
+		return ErrAlreadyExists
+	}
+
+	changeRDNAttributes(entry, oldDN[0], newRDN[0], change.DeleteOldRDN, schema)
+
+	// The entry and its descendants are moved
+	moved := make(map[string]*Entry)
+	for key, e := range set {
+		if key != oldKey && !strings.HasPrefix(key, oldKey+"\x00") {
+			continue
+		}
+		dn, err := ParseDN(e.DN)
+		if err != nil {
+			return err
+		}
+		e.DN = append(append(DN{}, dn[:len(dn)-len(oldDN)]...), newDN...).String()
+		delete(set, key)
+		moved[dnKey(e.DN)] = e
+	}
+	for key, e := range moved {
+		set[key] = e
+	}
+
+	return nil
+}
+
+// Changes the values of the RDN attributes in a renamed entry, as the server does in a modrdn: the
+// values of the new RDN are added, and those of the old one are deleted if deleteOldRDN is set
+func changeRDNAttributes(entry *Entry, oldRDN RDN, newRDN RDN, deleteOldRDN bool, schema *Schema) {
+	if deleteOldRDN {
+		for _, atav := range oldRDN {
+			name := entryAttributeName(entry, atav.Type, schema)
+			if position := indexOfValue(name, entry.Attributes[name], atav.Value, schema); position >= 0 {
+				values := entry.Attributes[name]
+				entry.Attributes[name] = append(values[:position:position], values[position+1:]...)
+				if len(entry.Attributes[name]) == 0 {
+					delete(entry.Attributes, name)
+				}
+			}
+		}
+	}
+	for _, atav := range newRDN {
+		name := entryAttributeName(entry, atav.Type, schema)
+		if indexOfValue(name, entry.Attributes[name], atav.Value, schema) < 0 {
+			entry.Attributes[name] = append(entry.Attributes[name], atav.Value)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package ldif
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseChanges(t *testing.T) {
+	changes := `
+version: 1
+
+dn: cn=new,dc=example,dc=com
+changetype: add
+objectClass: person
+cn: new
+
+dn: olcDatabase={1}mdb,cn=config
+changetype: modify
+replace: olcSuffix
+olcSuffix: dc=example,dc=com
+-
+delete: olcAccess
+olcAccess: {0}
+-
+add: olcDbIndex
+olcDbIndex: uid eq
+olcDbIndex: cn eq
+
+dn: olcDatabase={2}mdb,cn=config
+changetype: modrdn
+newrdn: olcDatabase={1}mdb
+deleteoldrdn: 1
+
+dn: cn=old,dc=example,dc=com
+control: 1.2.840.113556.1.4.805 true
+changetype: delete
+`
+	records, err := ParseChanges(strings.NewReader(changes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records, got %d", len(records))
+	}
+	if records[0].ChangeType != ChangeAdd || records[0].Attributes["cn"][0] != "new" {
+		t.Errorf("Bad add record: %+v", records[0])
+	}
+	mods := records[1].Modifications
+	if len(mods) != 3 || mods[1].Type != ModDelete || mods[1].Values[0] != "{0}" || len(mods[2].Values) != 2 {
+		t.Errorf("Bad modifications: %+v", mods)
+	}
+	if records[2].NewRDN != "olcDatabase={1}mdb" || !records[2].DeleteOldRDN {
+		t.Errorf("Bad modrdn record: %+v", records[2])
+	}
+	if records[3].ChangeType != ChangeDelete {
+		t.Errorf("Bad delete record: %+v", records[3])
+	}
+
+	// The output of the diff is read back
+	formatted := FormatChanges(records)
+	again, err := ParseChanges(strings.NewReader(formatted))
+	if err != nil || FormatChanges(again) != formatted {
+		t.Errorf("Changes not read back: %v\n%s", err, FormatChanges(again))
+	}
+
+	for _, invalid := range []string{
+		"dn: cn=a\nchangetype: rename\n",
+		"dn: cn=a\nchangetype: modify\nincrement: uidNumber\n",
+		"dn: cn=a\nchangetype: modify\nadd: cn\nsn: x\n",
+		"dn: cn=a\nchangetype: modrdn\ndeleteoldrdn: 1\n",
+	} {
+		if _, err := ParseChanges(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	content := `
+dn: cn=config
+objectClass: olcGlobal
+cn: config
+olcLogLevel: stats
+
+dn: olcDatabase={0}config,cn=config
+objectClass: olcDatabaseConfig
+olcDatabase: {0}config
+
+dn: olcDatabase={1}mdb,cn=config
+objectClass: olcDatabaseConfig
+olcDatabase: {1}mdb
+olcAccess: {0}to attrs=userPassword by self write
+olcAccess: {1}to * by * read
+olcDbIndex: objectClass eq
+
+dn: olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config
+objectClass: olcSyncProvConfig
+olcOverlay: {0}syncprov
+`
+	changes := `
+dn: olcDatabase={1}mdb,cn=config
+changetype: modrdn
+newrdn: olcDatabase={2}mdb
+deleteoldrdn: 1
+
+dn: olcDatabase={1}monitor,cn=config
+changetype: add
+objectClass: olcDatabaseConfig
+olcDatabase: {1}monitor
+
+dn: olcDatabase={2}mdb,cn=config
+changetype: modify
+add: olcAccess
+olcAccess: {1}to dn.base="" by * read
+-
+delete: olcAccess
+olcAccess: {0}
+-
+delete: olcDbIndex
+olcDbIndex: OBJECTCLASS   EQ
+-
+replace: olcSuffix
+olcSuffix: dc=example,dc=com
+
+dn: cn=config
+changetype: modify
+delete: olcLogLevel
+`
+	expected := `dn: cn=config
+cn: config
+objectClass: olcGlobal
+
+dn: olcDatabase={0}config,cn=config
+objectClass: olcDatabaseConfig
+olcDatabase: {0}config
+
+dn: olcDatabase={1}monitor,cn=config
+objectClass: olcDatabaseConfig
+olcDatabase: {1}monitor
+
+dn: olcDatabase={2}mdb,cn=config
+objectClass: olcDatabaseConfig
+olcAccess: {0}to dn.base="" by * read
+olcAccess: {1}to * by * read
+olcDatabase: {2}mdb
+olcSuffix: dc=example,dc=com
+
+dn: olcOverlay={0}syncprov,olcDatabase={2}mdb,cn=config
+objectClass: olcSyncProvConfig
+olcOverlay: {0}syncprov
+
+`
+	entries, _ := Parse(strings.NewReader(content))
+	records, err := ParseChanges(strings.NewReader(changes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Apply(entries, records, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.String() != expected {
+		t.Errorf("Bad result:\n%s", result)
+	}
+
+	// The input is not changed
+	if entries[2].DN != "olcDatabase={1}mdb,cn=config" || len(entries[2].Attributes["olcAccess"]) != 2 {
+		t.Errorf("Input entries changed: %s", entries[2])
+	}
+
+	errorCases := []struct {
+		changes  string
+		expected error
+	}{
+		{"dn: cn=config\nchangetype: add\ncn: config\n", ErrAlreadyExists},
+		{"dn: cn=missing\nchangetype: delete\n", ErrNoSuchObject},
+		{"dn: olcDatabase={1}mdb,cn=config\nchangetype: delete\n", ErrNotAllowedOnNonLeaf},
+		{"dn: cn=config\nchangetype: modify\nadd: cn\ncn: CONFIG\n", ErrValueExists},
+		{"dn: cn=config\nchangetype: modify\ndelete: olcLogLevel\nolcLogLevel: sync\n", ErrNoSuchAttribute},
+		{"dn: olcDatabase={0}config,cn=config\nchangetype: modrdn\nnewrdn: olcDatabase={1}mdb\ndeleteoldrdn: 1\n", ErrAlreadyExists},
+	}
+	for _, c := range errorCases {
+		records, err := ParseChanges(strings.NewReader(c.changes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Apply(entries, records, DefaultOptions()); !errors.Is(err, c.expected) {
+			t.Errorf("Expected %v applying %q, got %v", c.expected, c.changes, err)
+		}
+	}
+}
+
+func TestApplyModRDNNewSuperior(t *testing.T) {
+	content := `
+dn: dc=example,dc=com
+dc: example
+
+dn: ou=people,dc=example,dc=com
+ou: people
+
+dn: ou=staff,dc=example,dc=com
+ou: staff
+
+dn: uid=jdoe,ou=people,dc=example,dc=com
+uid: jdoe
+cn: John Doe
+`
+	changes := `
+dn: uid=jdoe,ou=people,dc=example,dc=com
+changetype: moddn
+newrdn: cn=John Doe
+deleteoldrdn: 0
+newsuperior: ou=staff,dc=example,dc=com
+`
+	entries, _ := Parse(strings.NewReader(content))
+	records, _ := ParseChanges(strings.NewReader(changes))
+	result, err := Apply(entries, records, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := result[len(result)-1]
+	if moved.DN != "cn=John Doe,ou=staff,dc=example,dc=com" || moved.Attributes["uid"][0] != "jdoe" || len(moved.Attributes["cn"]) != 1 {
+		t.Errorf("Bad moved entry: %s", moved)
+	}
+}
@@ -0,0 +1,165 @@
+package ldif
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reading of ldapmodify change records, as generated by Diff
+
+// Kinds of errors in change records, to be checked with errors.Is
+var (
+	ErrInvalidChangeType   = errors.New("invalid changetype")
+	ErrInvalidModification = errors.New("invalid modification")
+	ErrNoSuchObject        = errors.New("no such object")
+	ErrAlreadyExists       = errors.New("entry already exists")
+	ErrNotAllowedOnNonLeaf = errors.New("operation not allowed on non leaf")
+	ErrNoSuchAttribute     = errors.New("no such attribute or value")
+	ErrValueExists         = errors.New("attribute or value exists")
+)
+
+// ParseChanges reads an ldif with change records, as used by ldapmodify. Records without
+// changetype are treated as adds, and records without dn are errors
+func ParseChanges(r io.Reader) ([]ChangeRecord, error) {
+
+	records, err := readRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]ChangeRecord, 0)
+	for _, record := range records {
+		change, err := parseChangeRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// Builds a change record from the lines in a record
+func parseChangeRecord(record []ldifLine) (ChangeRecord, error) {
+	var change ChangeRecord
+
+	attr, dn, err := parseAttrValue(record[0])
+	if err != nil {
+		return change, err
+	}
+	if !strings.EqualFold(attr, "dn") {
+		return change, &ParseError{Line: record[0].number, Err: ErrMissingDN, Text: record[0].text}
+	}
+	change.DN = dn
+	lines := record[1:]
+
+	// Controls are not supported, and are ignored
+	for len(lines) > 0 && strings.HasPrefix(strings.ToLower(lines[0].text), "control:") {
+		lines = lines[1:]
+	}
+
+	change.ChangeType = ChangeAdd
+	if len(lines) > 0 && strings.HasPrefix(strings.ToLower(lines[0].text), "changetype:") {
+		_, changeType, err := parseAttrValue(lines[0])
+		if err != nil {
+			return change, err
+		}
+		change.ChangeType = ChangeType(strings.ToLower(strings.TrimSpace(changeType)))
+		if change.ChangeType == "moddn" {
+			change.ChangeType = ChangeModRDN
+		}
+		lines = lines[1:]
+	}
+
+	switch change.ChangeType {
+	case ChangeAdd:
+		entry, err := parseRecord(append([]ldifLine{record[0]}, lines...))
+		if err != nil {
+			return change, err
+		}
+		change.Attributes = entry.Attributes
+
+	case ChangeDelete:
+		if len(lines) > 0 {
+			return change, &ParseError{Line: lines[0].number, Err: ErrInvalidModification, Text: lines[0].text}
+		}
+
+	case ChangeModify:
+		change.Modifications, err = parseModifications(lines)
+		if err != nil {
+			return change, err
+		}
+
+	case ChangeModRDN:
+		for _, line := range lines {
+			attr, value, err := parseAttrValue(line)
+			if err != nil {
+				return change, err
+			}
+			switch strings.ToLower(attr) {
+			case "newrdn":
+				change.NewRDN = value
+			case "deleteoldrdn":
+				change.DeleteOldRDN = strings.TrimSpace(value) == "1"
+			case "newsuperior":
+				change.NewSuperior = value
+			default:
+				return change, &ParseError{Line: line.number, Err: ErrInvalidModification, Text: line.text}
+			}
+		}
+		if change.NewRDN == "" {
+			return change, &ParseError{Line: record[0].number, Err: fmt.Errorf("%w: missing newrdn", ErrInvalidModification), Text: record[0].text}
+		}
+
+	default:
+		return change, &ParseError{Line: record[0].number, Err: ErrInvalidChangeType, Text: string(change.ChangeType)}
+	}
+
+	return change, nil
+}
+
+// Parses the body of a changetype: modify record, made of groups of lines separated by "-".
+// Each group starts with add:, delete: or replace: and the attribute name, followed by the values
+func parseModifications(lines []ldifLine) ([]Modification, error) {
+	mods := make([]Modification, 0)
+
+	var mod *Modification
+	for _, line := range lines {
+		if strings.TrimSpace(line.text) == "-" {
+			if mod == nil {
+				return nil, &ParseError{Line: line.number, Err: ErrInvalidModification, Text: line.text}
+			}
+			mods = append(mods, *mod)
+			mod = nil
+			continue
+		}
+
+		attr, value, err := parseAttrValue(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if mod == nil {
+			modType := ModType(strings.ToLower(attr))
+			if modType != ModAdd && modType != ModDelete && modType != ModReplace {
+				return nil, &ParseError{Line: line.number, Err: ErrInvalidModification, Text: line.text}
+			}
+			mod = &Modification{Type: modType, Attribute: strings.TrimSpace(value)}
+			continue
+		}
+
+		if !strings.EqualFold(attr, mod.Attribute) {
+			return nil, &ParseError{Line: line.number, Err: fmt.Errorf("%w: expected values of %s", ErrInvalidModification, mod.Attribute), Text: line.text}
+		}
+		mod.Values = append(mod.Values, value)
+	}
+
+	// The last "-" is optional
+	if mod != nil {
+		mods = append(mods, *mod)
+	}
+
+	return mods, nil
+}
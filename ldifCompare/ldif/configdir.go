@@ -0,0 +1,108 @@
+package ldif
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Conversion of the configuration in slapd.d directory format, or slapd.conf format, to ldif
+
+// SlaptestCommand is the command used to convert slapd.conf files to slapd.d directories
+var SlaptestCommand = "slaptest"
+
+// OperationalAttributes are the attributes maintained by slapd, which are not part of the configuration
+var OperationalAttributes = []string{
+	"structuralObjectClass",
+	"entryUUID",
+	"creatorsName",
+	"createTimestamp",
+	"entryCSN",
+	"modifiersName",
+	"modifyTimestamp",
+	"contextCSN",
+	"hasSubordinates",
+	"subschemaSubentry",
+}
+
+// ReadConfigDir reads a slapd.d directory and returns its entries, with their operational attributes, which
+// are ignored with the default IgnoreRules, as the ones of the current configuration
+// Each .ldif file holds one entry, whose dn is relative to the entry in the parent directory, and
+// the children of the entry in file X.ldif are in the directory X
+func ReadConfigDir(dir string) (EntryList, error) {
+	entries := make(EntryList, 0)
+	if err := readConfigDirLevel(dir, "", &entries); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(entries)
+
+	return entries, nil
+}
+
+// Reads the .ldif files in the directory, which are children of the entry with the specified dn,
+// and then recursively the directories with their children
+func readConfigDirLevel(dir string, parentDN string, entries *EntryList) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".ldif") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+
+		fileBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fileEntries, err := Parse(bytes.NewReader(fileBytes))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if len(fileEntries) != 1 {
+			return fmt.Errorf("%s: expected one entry but found %d", path, len(fileEntries))
+		}
+
+		entry := fileEntries[0]
+		if parentDN != "" {
+			entry.DN = entry.DN + "," + parentDN
+		}
+		*entries = append(*entries, entry)
+
+		childrenDir := strings.TrimSuffix(path, ".ldif")
+		if info, err := os.Stat(childrenDir); err == nil && info.IsDir() {
+			if err := readConfigDirLevel(childrenDir, entry.DN, entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ConvertConfigFile converts a configuration file in slapd.conf format to a list of entries, using
+// slaptest to generate the slapd.d directory in a temporary location
+func ConvertConfigFile(confFile string) (EntryList, error) {
+	dir, err := ioutil.TempDir("", "slapd.d")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(SlaptestCommand, "-n", "0", "-f", confFile, "-F", dir)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", SlaptestCommand, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ReadConfigDir(dir)
+}
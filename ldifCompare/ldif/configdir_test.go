@@ -0,0 +1,102 @@
+package ldif
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes a slapd.d tree as generated by slaptest
+func writeConfigDir(t *testing.T, dir string) {
+	files := map[string]string{
+		"cn=config.ldif": "# AUTO-GENERATED FILE - DO NOT EDIT!! Use ldapmodify.\n# CRC32 3b6a3b1a\n" +
+			"dn: cn=config\nobjectClass: olcGlobal\ncn: config\nolcPidFile: /usr/local/var/run/slapd.pid\n" +
+			"structuralObjectClass: olcGlobal\nentryUUID: 6e5d0a64-cf2a-103b-8d3a-c7d0d1e3b0a1\n" +
+			"creatorsName: cn=config\ncreateTimestamp: 20211024101010Z\nentryCSN: 20211024101010.123456Z#000000#000#000000\n" +
+			"modifiersName: cn=config\nmodifyTimestamp: 20211024101010Z\n",
+		"cn=config/olcDatabase={1}mdb.ldif": "dn: olcDatabase={1}mdb\nobjectClass: olcMdbConfig\nolcDatabase: {1}mdb\n" +
+			"olcAccess: {0}to *\n  by * read\n",
+		"cn=config/olcDatabase={1}mdb/olcOverlay={0}ppolicy.ldif": "dn: olcOverlay={0}ppolicy\nolcOverlay: {0}ppolicy\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slapd.d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeConfigDir(t, dir)
+
+	entries, err := ReadConfigDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The operational attributes are kept, to be ignored on both sides of the comparison
+	if len(entries) == 0 || len(entries[0].Attributes["entryCSN"]) != 1 {
+		t.Fatalf("Operational attributes not read from slapd.d:\n%s", entries)
+	}
+	DefaultIgnoreRules().Apply(entries)
+
+	expected := `dn: cn=config
+cn: config
+objectClass: olcGlobal
+olcPidFile: /usr/local/var/run/slapd.pid
+
+dn: olcDatabase={1}mdb,cn=config
+objectClass: olcMdbConfig
+olcAccess: {0}to * by * read
+olcDatabase: {1}mdb
+
+dn: olcOverlay={0}ppolicy,olcDatabase={1}mdb,cn=config
+olcOverlay: {0}ppolicy
+
+`
+	if entries.String() != expected {
+		t.Fatalf("Bad entries read from slapd.d:\n%s", entries)
+	}
+}
+
+func TestConvertConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slaptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake slaptest, that copies a prebuilt slapd.d tree to the directory specified with -F
+	writeConfigDir(t, filepath.Join(dir, "tree"))
+	script := "#!/bin/sh\nwhile [ $# -gt 0 ]; do if [ \"$1\" = -F ]; then cp -r " + filepath.Join(dir, "tree") + "/. \"$2\"; fi; shift; done\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "slaptest"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(command string) { SlaptestCommand = command }(SlaptestCommand)
+	SlaptestCommand = filepath.Join(dir, "slaptest")
+
+	entries, err := ConvertConfigFile("slapd.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].DN != "olcOverlay={0}ppolicy,olcDatabase={1}mdb,cn=config" {
+		t.Fatalf("Bad entries converted from slapd.conf:\n%s", entries)
+	}
+
+	// Errors of slaptest are reported
+	SlaptestCommand = "false"
+	if _, err := ConvertConfigFile("slapd.conf"); err == nil || !strings.Contains(err.Error(), "false failed") {
+		t.Fatal("Expected slaptest error but got", err)
+	}
+}
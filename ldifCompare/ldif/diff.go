@@ -0,0 +1,300 @@
+package ldif
+
+import (
+	"sort"
+	"strings"
+)
+
+// ChangeType is the type of an ldapmodify change record
+type ChangeType string
+
+// Change types, as written in the changetype: line
+const (
+	ChangeAdd    ChangeType = "add"
+	ChangeDelete ChangeType = "delete"
+	ChangeModify ChangeType = "modify"
+	ChangeModRDN ChangeType = "modrdn"
+)
+
+// ModType is the type of a modification inside a changetype: modify record
+type ModType string
+
+// Modification types
+const (
+	ModAdd     ModType = "add"
+	ModDelete  ModType = "delete"
+	ModReplace ModType = "replace"
+)
+
+// Modification is a change in the values of a single attribute
+type Modification struct {
+	Type      ModType
+	Attribute string
+	Values    []string
+}
+
+// ChangeRecord is one of the records in an ldapmodify file
+// Attributes is used for adds, Modifications for modifies and the NewRDN, DeleteOldRDN and
+// NewSuperior fields for modrdn
+type ChangeRecord struct {
+	DN            string
+	ChangeType    ChangeType
+	Attributes    map[string][]string
+	Modifications []Modification
+	NewRDN        string
+	DeleteOldRDN  bool
+	NewSuperior   string
+}
+
+// String returns the change record in ldapmodify format, followed by a blank line
+func (c ChangeRecord) String() string {
+	var builder strings.Builder
+	builder.WriteString(formatAttrValue("dn", c.DN) + "\n")
+	builder.WriteString("changetype: " + string(c.ChangeType) + "\n")
+
+	switch c.ChangeType {
+	case ChangeAdd:
+		builder.WriteString(Entry{DN: c.DN, Attributes: c.Attributes}.serializeAttributes())
+	case ChangeModify:
+		for i, mod := range c.Modifications {
+			if i > 0 {
+				builder.WriteString("-\n")
+			}
+			builder.WriteString(string(mod.Type) + ": " + mod.Attribute + "\n")
+			for _, value := range mod.Values {
+				builder.WriteString(formatAttrValue(mod.Attribute, value) + "\n")
+			}
+		}
+	case ChangeModRDN:
+		builder.WriteString(formatAttrValue("newrdn", c.NewRDN) + "\n")
+		if c.DeleteOldRDN {
+			builder.WriteString("deleteoldrdn: 1\n")
+		} else {
+			builder.WriteString("deleteoldrdn: 0\n")
+		}
+		if c.NewSuperior != "" {
+			builder.WriteString(formatAttrValue("newsuperior", c.NewSuperior) + "\n")
+		}
+	}
+
+	builder.WriteString("\n")
+	return builder.String()
+}
+
+// FormatChanges returns the change records in ldapmodify format
+func FormatChanges(changes []ChangeRecord) string {
+	var builder strings.Builder
+	for _, change := range changes {
+		builder.WriteString(change.String())
+	}
+	return builder.String()
+}
+
+// Diff generates the changes to apply to currentLdif to get targetLdif
+// Both lists must be sorted, as returned by Parse
+// Renamed entries (see Options) are moved first, then deletes are generated, leaf entries before
+// their parents, then the renames of renumbered ordered entries (olcDatabase={n}...), and then
+// adds and modifies, parent entries before their children, so that the changes can always be
+// applied in order
+func Diff(targetLdif EntryList, currentLdif EntryList) []ChangeRecord {
+	return DiffWithOptions(targetLdif, currentLdif, DefaultOptions())
+}
+
+// DiffWithOptions is as Diff, with the specified options
+func DiffWithOptions(targetLdif EntryList, currentLdif EntryList, options Options) []ChangeRecord {
+	currentPos := 0
+	targetPos := 0
+
+	// Current entries are compared using the DN they will have after the renames
+	moves, movedLdif := detectRenames(targetLdif, currentLdif, options)
+	renames, currentWorking := detectOrderedRenames(targetLdif, movedLdif)
+	sort.SliceStable(currentWorking, func(i, j int) bool {
+		return CompareDN(currentWorking[i].DN, currentWorking[j].DN) < 0
+	})
+
+	deletes := make([]ChangeRecord, 0)
+	changes := make([]ChangeRecord, 0)
+
+	// Target & Current are ldapentries(dn + attributes)
+	// Target exists
+	//	Current exists
+	//	  compare entries
+	//  Current does not exist
+	//	  add
+	// Target does not exist
+	//	Current exists
+	//	  delete
+	//  Current does not exist
+	//	  break
+
+	var operation string
+	for {
+		if targetPos < len(targetLdif) {
+			if currentPos < len(currentWorking) {
+				// Both lists are sorted hierarchically (see CompareDN)
+				switch CompareDN(currentWorking[currentPos].DN, targetLdif[targetPos].DN) {
+				case -1:
+					operation = "delete"
+				case 1:
+					operation = "add"
+				default:
+					operation = "compare"
+				}
+			} else {
+				operation = "add"
+			}
+		} else {
+			if currentPos < len(currentWorking) {
+				operation = "delete"
+			} else {
+				break
+			}
+		}
+
+		switch operation {
+		case "add":
+			changes = append(changes, ChangeRecord{
+				DN:         targetLdif[targetPos].DN,
+				ChangeType: ChangeAdd,
+				Attributes: targetLdif[targetPos].Attributes,
+			})
+			targetPos++
+		case "compare":
+			if change, changed := diffEntry(targetLdif[targetPos], currentWorking[currentPos].Entry, options); changed {
+				changes = append(changes, change)
+			}
+			currentPos++
+			targetPos++
+		case "delete":
+			// Deletes are applied before the renames
+			deletes = append(deletes, ChangeRecord{
+				DN:         currentWorking[currentPos].originalDN,
+				ChangeType: ChangeDelete,
+			})
+			currentPos++
+		}
+	}
+
+	// The deletes were found parents first. Reverse them to delete the leaf entries before
+	for i, j := 0, len(deletes)-1; i < j; i, j = i+1, j-1 {
+		deletes[i], deletes[j] = deletes[j], deletes[i]
+	}
+
+	return append(append(append(moves, deletes...), renames...), changes...)
+}
+
+// Rollback generates the changes that undo the ones generated by DiffWithOptions for the same
+// inputs, that is, the changes to get currentLdif back from targetLdif. Deleted entries are added back
+// with all their attributes, and deleted values are added back as they were in currentLdif
+func Rollback(targetLdif EntryList, currentLdif EntryList, options Options) []ChangeRecord {
+	options.Renames = reverseRenames(options.Renames)
+	return DiffWithOptions(currentLdif, targetLdif, options)
+}
+
+// DiffEntry generates the modify record to change the currentEntry attributes to the targetEntry attributes
+// The second return value is false if there are no differences
+func DiffEntry(targetEntry Entry, currentEntry Entry) (ChangeRecord, bool) {
+	return diffEntry(targetEntry, currentEntry, DefaultOptions())
+}
+
+func diffEntry(targetEntry Entry, currentEntry Entry, options Options) (ChangeRecord, bool) {
+
+	change := ChangeRecord{
+		DN:         targetEntry.DN,
+		ChangeType: ChangeModify,
+	}
+
+	// Attribute names are compared ignoring case, and using the schema to match aliases
+	targetAttributes, targetNames := foldAttributes(targetEntry, options.Schema)
+	currentAttributes, currentNames := foldAttributes(currentEntry, options.Schema)
+
+	for _, key := range unionOfKeys(targetNames, currentNames) {
+		targetValues := targetAttributes[key]
+		currentValues := currentAttributes[key]
+		name, found := targetNames[key]
+		if !found {
+			name = currentNames[key]
+		}
+
+		added, deleted := diffValues(name, targetValues, currentValues, options.Schema)
+		if len(added) == 0 && len(deleted) == 0 {
+			continue
+		}
+
+		// The whole set of values is replaced in a single operation
+		if options.useReplace(name, targetValues, currentValues) {
+			change.Modifications = append(change.Modifications, Modification{Type: ModReplace, Attribute: name, Values: targetValues})
+			continue
+		}
+
+		// Values with {n} prefixes are changed in place, keeping the ones that do not move
+		if isOrderedAttribute(targetValues, currentValues) {
+			change.Modifications = append(change.Modifications, diffOrderedValues(name, targetValues, currentValues, options.Schema)...)
+			continue
+		}
+
+		// Old values are deleted before adding the new ones
+		if len(deleted) > 0 {
+			change.Modifications = append(change.Modifications, Modification{Type: ModDelete, Attribute: name, Values: deleted})
+		}
+		if len(added) > 0 {
+			change.Modifications = append(change.Modifications, Modification{Type: ModAdd, Attribute: name, Values: added})
+		}
+	}
+
+	return change, len(change.Modifications) > 0
+}
+
+// Groups the values of the attributes by the key of the attribute name (see Schema.AttributeKey).
+// Returns the values and the name, as written in the entry, for each key
+func foldAttributes(entry Entry, schema *Schema) (map[string][]string, map[string]string) {
+	values := make(map[string][]string, len(entry.Attributes))
+	names := make(map[string]string, len(entry.Attributes))
+	for _, name := range entry.AttributeNames() {
+		key := schema.AttributeKey(name)
+		if _, found := names[key]; !found {
+			names[key] = name
+		}
+		values[key] = append(values[key], entry.Attributes[name]...)
+	}
+	return values, names
+}
+
+// Returns the sorted keys present in any of the maps
+func unionOfKeys(a map[string]string, b map[string]string) []string {
+	union := NewEntry("")
+	for key := range a {
+		union.Attributes[key] = nil
+	}
+	for key := range b {
+		union.Attributes[key] = nil
+	}
+	return union.AttributeNames()
+}
+
+// Returns the values in target not in current (added), and the values in current
+// not in target (deleted), keeping the original order of the values
+// Values are compared using the equality matching rule of the attribute
+func diffValues(name string, targetValues []string, currentValues []string, schema *Schema) ([]string, []string) {
+	var added, deleted []string
+
+	currentSet := make(map[string]bool, len(currentValues))
+	for _, v := range currentValues {
+		currentSet[schema.NormalizeValue(name, v)] = true
+	}
+	targetSet := make(map[string]bool, len(targetValues))
+	for _, v := range targetValues {
+		normalized := schema.NormalizeValue(name, v)
+		targetSet[normalized] = true
+		if !currentSet[normalized] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range currentValues {
+		if !targetSet[schema.NormalizeValue(name, v)] {
+			deleted = append(deleted, v)
+		}
+	}
+
+	return added, deleted
+}
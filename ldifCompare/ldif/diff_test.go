@@ -0,0 +1,82 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffReplace(t *testing.T) {
+	current := `
+dn: cn=config
+olcLogLevel: stats
+description: old
+olcSaslSecProps: noplain
+`
+	target := `
+dn: cn=config
+olcLogLevel: stats sync
+description: new
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	cases := []struct {
+		mode     ReplaceMode
+		expected string
+	}{
+		{ReplaceKnown, "delete: description\ndescription: old\n-\nadd: description\ndescription: new\n-\nreplace: olcLogLevel\nolcLogLevel: stats sync\n-\ndelete: olcSaslSecProps\nolcSaslSecProps: noplain\n"},
+		{ReplaceSingle, "replace: description\ndescription: new\n-\nreplace: olcLogLevel\nolcLogLevel: stats sync\n-\ndelete: olcSaslSecProps\nolcSaslSecProps: noplain\n"},
+		{ReplaceNever, "delete: description\ndescription: old\n-\nadd: description\ndescription: new\n-\ndelete: olcLogLevel\nolcLogLevel: stats\n-\nadd: olcLogLevel\nolcLogLevel: stats sync\n-\ndelete: olcSaslSecProps\nolcSaslSecProps: noplain\n"},
+	}
+
+	for _, c := range cases {
+		options := DefaultOptions()
+		options.Replace = c.mode
+		changes := FormatChanges(DiffWithOptions(targetEntries, currentEntries, options))
+		expected := "dn: cn=config\nchangetype: modify\n" + c.expected + "\n"
+		if changes != expected {
+			t.Errorf("Bad changes for replace mode %d:\n%s", c.mode, changes)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	current := `
+dn: cn=config
+olcLogLevel: stats
+olcAttributeOptions: lang-
+olcAttributeOptions: x-
+
+dn: olcDatabase={2}monitor,cn=config
+objectClass: olcDatabaseConfig
+olcDatabase: {2}monitor
+olcMonitoring: FALSE
+`
+	target := `
+dn: cn=config
+olcLogLevel: sync
+olcAttributeOptions: lang-
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	rollback := FormatChanges(Rollback(targetEntries, currentEntries, DefaultOptions()))
+	expected := `dn: cn=config
+changetype: modify
+add: olcAttributeOptions
+olcAttributeOptions: x-
+-
+replace: olcLogLevel
+olcLogLevel: stats
+
+dn: olcDatabase={2}monitor,cn=config
+changetype: add
+objectClass: olcDatabaseConfig
+olcDatabase: {2}monitor
+olcMonitoring: FALSE
+
+`
+	if rollback != expected {
+		t.Fatalf("Bad rollback changes:\n%s", rollback)
+	}
+}
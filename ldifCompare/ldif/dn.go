@@ -0,0 +1,323 @@
+package ldif
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Parsing and comparison of distinguished names, as specified in RFC 4514
+
+// AttributeTypeAndValue is one of the components of an RDN, with the value unescaped
+type AttributeTypeAndValue struct {
+	Type  string
+	Value string
+}
+
+// RDN is a relative distinguished name, possibly multi-valued (cn=a+sn=b)
+type RDN []AttributeTypeAndValue
+
+// DN is a parsed distinguished name. As in the string form, the first RDN is the one of the leaf
+type DN []RDN
+
+// ParseDN parses the string representation of a distinguished name. Escaped characters, hex
+// pairs, quoted values and multi-valued RDNs are accepted. The empty string is the root DN
+func ParseDN(dn string) (DN, error) {
+	parsed := make(DN, 0)
+
+	if strings.TrimSpace(dn) == "" {
+		return parsed, nil
+	}
+
+	rdn := make(RDN, 0)
+	pos := 0
+	for {
+		atav, next, err := parseAttributeTypeAndValue(dn, pos)
+		if err != nil {
+			return nil, err
+		}
+		rdn = append(rdn, atav)
+		pos = next
+
+		if pos >= len(dn) {
+			parsed = append(parsed, rdn)
+			break
+		}
+
+		switch dn[pos] {
+		case '+':
+			// Another component of the same RDN
+		case ',', ';':
+			parsed = append(parsed, rdn)
+			rdn = make(RDN, 0)
+		}
+		pos++
+	}
+
+	return parsed, nil
+}
+
+// Parses a type=value starting in the specified position, and returns the position of the
+// separator that follows it, or the length of the string if there are no more components
+func parseAttributeTypeAndValue(dn string, pos int) (AttributeTypeAndValue, int, error) {
+	var atav AttributeTypeAndValue
+
+	equalPos := strings.IndexByte(dn[pos:], '=')
+	if equalPos < 0 {
+		return atav, 0, fmt.Errorf("missing '=' in %q", dn[pos:])
+	}
+	atav.Type = strings.TrimSpace(dn[pos : pos+equalPos])
+	if !isValidAttributeType(atav.Type) {
+		return atav, 0, fmt.Errorf("invalid attribute type %q", atav.Type)
+	}
+	pos += equalPos + 1
+
+	// Skip leading spaces
+	for pos < len(dn) && dn[pos] == ' ' {
+		pos++
+	}
+
+	var value []byte
+	switch {
+	case pos < len(dn) && dn[pos] == '#':
+		// Hex encoded BER value. Kept as is, in lowercase
+		end := pos + 1
+		for end < len(dn) && strings.IndexByte("0123456789abcdefABCDEF", dn[end]) >= 0 {
+			end++
+		}
+		value = []byte(strings.ToLower(dn[pos:end]))
+		pos = end
+
+	case pos < len(dn) && dn[pos] == '"':
+		// Quoted value, as allowed in RFC 2253
+		pos++
+		for {
+			if pos >= len(dn) {
+				return atav, 0, errors.New("unterminated quoted value")
+			}
+			if dn[pos] == '"' {
+				pos++
+				break
+			}
+			if dn[pos] == '\\' {
+				c, next, err := unescapeDNChar(dn, pos)
+				if err != nil {
+					return atav, 0, err
+				}
+				value = append(value, c)
+				pos = next
+				continue
+			}
+			value = append(value, dn[pos])
+			pos++
+		}
+
+	default:
+		// Regular value. Unescaped trailing spaces are not part of the value
+		significantLen := 0
+		for pos < len(dn) && strings.IndexByte(",;+", dn[pos]) < 0 {
+			if dn[pos] == '\\' {
+				c, next, err := unescapeDNChar(dn, pos)
+				if err != nil {
+					return atav, 0, err
+				}
+				value = append(value, c)
+				significantLen = len(value)
+				pos = next
+				continue
+			}
+			if dn[pos] == '"' {
+				return atav, 0, fmt.Errorf("unescaped '\"' in %q", dn)
+			}
+			value = append(value, dn[pos])
+			if dn[pos] != ' ' {
+				significantLen = len(value)
+			}
+			pos++
+		}
+		value = value[:significantLen]
+	}
+
+	// Skip trailing spaces before the separator
+	for pos < len(dn) && dn[pos] == ' ' {
+		pos++
+	}
+	if pos < len(dn) && strings.IndexByte(",;+", dn[pos]) < 0 {
+		return atav, 0, fmt.Errorf("unexpected character %q in %q", dn[pos], dn)
+	}
+	if pos == len(dn)-1 {
+		return atav, 0, fmt.Errorf("dn %q ends with a separator", dn)
+	}
+
+	atav.Value = string(value)
+	return atav, pos, nil
+}
+
+// Decodes the escape sequence starting at pos, that is, a backslash followed by either
+// a special character or two hex digits. Returns the byte and the position after the sequence
+func unescapeDNChar(dn string, pos int) (byte, int, error) {
+	if pos+1 >= len(dn) {
+		return 0, 0, fmt.Errorf("dn %q ends with an escape character", dn)
+	}
+	if pos+2 < len(dn) {
+		if decoded, err := hex.DecodeString(dn[pos+1 : pos+3]); err == nil {
+			return decoded[0], pos + 3, nil
+		}
+	}
+	return dn[pos+1], pos + 2, nil
+}
+
+// Attribute types are either a descriptor (letter followed by letters, digits or hyphens)
+// or a numeric OID
+func isValidAttributeType(attrType string) bool {
+	if attrType == "" {
+		return false
+	}
+	isOID := attrType[0] >= '0' && attrType[0] <= '9'
+	for i := 0; i < len(attrType); i++ {
+		c := attrType[i]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' && isOID:
+		case (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') && !isOID:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Escapes the special characters of an attribute value, for the string representation of a DN
+func escapeDNValue(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte(",+\"\\<>;=", c) >= 0:
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c == 0:
+			builder.WriteString("\\00")
+		case (c == ' ' || c == '#') && i == 0:
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c == ' ' && i == len(value)-1:
+			builder.WriteString("\\ ")
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+// String returns the RDN in string form, with the components in the original order
+func (r RDN) String() string {
+	components := make([]string, len(r))
+	for i, atav := range r {
+		components[i] = atav.Type + "=" + escapeDNValue(atav.Value)
+	}
+	return strings.Join(components, "+")
+}
+
+// Normalized returns the RDN in a form suitable for comparison: attribute types and values
+// in lowercase, whitespace in values collapsed and components of multi-valued RDNs sorted
+func (r RDN) Normalized() string {
+	components := make([]string, len(r))
+	for i, atav := range r {
+		components[i] = strings.ToLower(atav.Type) + "=" + escapeDNValue(normalizeDNValue(atav.Value))
+	}
+	sort.Strings(components)
+	return strings.Join(components, "+")
+}
+
+// Values are compared ignoring case and with consecutive spaces collapsed
+func normalizeDNValue(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
+
+// String returns the DN in string form
+func (d DN) String() string {
+	rdns := make([]string, len(d))
+	for i, rdn := range d {
+		rdns[i] = rdn.String()
+	}
+	return strings.Join(rdns, ",")
+}
+
+// Normalized returns the DN in a form suitable for comparison
+func (d DN) Normalized() string {
+	rdns := make([]string, len(d))
+	for i, rdn := range d {
+		rdns[i] = rdn.Normalized()
+	}
+	return strings.Join(rdns, ",")
+}
+
+// Parent returns the DN of the parent entry. The parent of the root DN is the root DN
+func (d DN) Parent() DN {
+	if len(d) == 0 {
+		return d
+	}
+	return d[1:]
+}
+
+// Returns the normalized RDNs of the DN, starting from the root. Used as the sort key for entries
+// DNs that cannot be parsed are treated as a single RDN with the lowercased string
+func dnSortKey(dn string) []string {
+	parsed, err := ParseDN(dn)
+	if err != nil {
+		return []string{strings.ToLower(strings.TrimSpace(dn))}
+	}
+	key := make([]string, len(parsed))
+	for i, rdn := range parsed {
+		key[len(parsed)-1-i] = rdnSortKey(rdn)
+	}
+	return key
+}
+
+// The sort key of an RDN is its normalized form, but with the {n} index of ordered values
+// zero padded, so that {10} is sorted after {2} and {-1} before {0}
+func rdnSortKey(rdn RDN) string {
+	if len(rdn) == 1 {
+		if index, bareValue, ok := splitOrderedValue(rdn[0].Value); ok {
+			return fmt.Sprintf("%s={%010d}%s", strings.ToLower(rdn[0].Type), index+1, escapeDNValue(normalizeDNValue(bareValue)))
+		}
+	}
+	return rdn.Normalized()
+}
+
+// NormalizeDN returns the normalized form of the DN, or the lowercased string if it cannot be parsed
+func NormalizeDN(dn string) string {
+	parsed, err := ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	return parsed.Normalized()
+}
+
+// CompareDN compares two DNs hierarchically, returning -1, 0 or 1. Parents are sorted before
+// their children, and siblings by their normalized RDN. Equivalent DNs compare as 0
+func CompareDN(a string, b string) int {
+	return compareDNKeys(dnSortKey(a), dnSortKey(b))
+}
+
+func compareDNKeys(a []string, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
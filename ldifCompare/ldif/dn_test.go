@@ -0,0 +1,95 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDN(t *testing.T) {
+	cases := []struct {
+		dn         string
+		normalized string
+	}{
+		{"cn=Config", "cn=config"},
+		{"olcDatabase={1}mdb, cn=config", "olcdatabase={1}mdb,cn=config"},
+		{"CN = John  Smith ,OU=People;dc=example", "cn=john smith,ou=people,dc=example"},
+		{"sn=Smith+cn=John,dc=example", "cn=john+sn=smith,dc=example"},
+		{`cn=Smith\, John,dc=example`, `cn=smith\, john,dc=example`},
+		{`cn=Smith\2C John,dc=example`, `cn=smith\, john,dc=example`},
+		{`cn="Smith, John",dc=example`, `cn=smith\, john,dc=example`},
+		{`cn=\ leading,dc=example`, `cn=leading,dc=example`},
+		{`cn=\C3\B1and\C3\BA,dc=example`, "cn=ñandú,dc=example"},
+		{"1.3.6.1.4.1.1466.0=#04024869,dc=example", `1.3.6.1.4.1.1466.0=\#04024869,dc=example`},
+		{"", ""},
+	}
+
+	for _, c := range cases {
+		parsed, err := ParseDN(c.dn)
+		if err != nil {
+			t.Fatalf("Could not parse %q: %s", c.dn, err)
+		}
+		if parsed.Normalized() != c.normalized {
+			t.Errorf("Bad normalization for %q: %q", c.dn, parsed.Normalized())
+		}
+	}
+
+	for _, invalid := range []string{"cn", "cn=a,", "cn=a,b", `cn=a\`, `cn="unterminated`, "c n=a"} {
+		if _, err := ParseDN(invalid); err == nil {
+			t.Errorf("Expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestCompareDN(t *testing.T) {
+	if CompareDN("cn=Config", "CN=config") != 0 {
+		t.Error("Case should be ignored")
+	}
+	if CompareDN("cn=config", "olcDatabase={1}mdb,cn=config") >= 0 {
+		t.Error("Parent should be before child")
+	}
+	if CompareDN("cn=ab,dc=x", "cn=a,dc=x") <= 0 || CompareDN("cn=a,cn=ab,dc=x", "cn=ab,dc=x") <= 0 {
+		t.Error("Bad sibling order")
+	}
+	if CompareDN("cn=b,cn=a,dc=x", "cn=ab,dc=x") >= 0 {
+		t.Error("Children should be just after their parent")
+	}
+}
+
+func TestDiffOrdering(t *testing.T) {
+	current := `
+dn: dc=x
+objectClass: top
+
+dn: ou=old,dc=x
+objectClass: top
+
+dn: cn=leaf,ou=old,dc=x
+objectClass: top
+`
+	target := `
+dn: DC=X
+objectClass: top
+
+dn: cn=leaf,ou=new,dc=x
+objectClass: top
+
+dn: ou=new,dc=x
+objectClass: top
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	var order []string
+	for _, change := range Diff(targetEntries, currentEntries) {
+		order = append(order, string(change.ChangeType)+" "+change.DN)
+	}
+	expected := []string{
+		"delete cn=leaf,ou=old,dc=x",
+		"delete ou=old,dc=x",
+		"add ou=new,dc=x",
+		"add cn=leaf,ou=new,dc=x",
+	}
+	if strings.Join(order, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Bad order of changes:\n%s", strings.Join(order, "\n"))
+	}
+}
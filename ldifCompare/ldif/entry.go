@@ -0,0 +1,99 @@
+// Package ldif reads LDIF files, compares sets of ldap entries and generates the
+// ldapmodify change records to move from one set to another
+package ldif
+
+import (
+	"sort"
+	"strings"
+)
+
+// ---------------------- Types
+
+// Entry represents an entry in the ldap tree
+// Attribute values are stored as the raw bytes, after base64 or url decoding
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// NewEntry creates an entry with no attributes
+func NewEntry(dn string) Entry {
+	return Entry{
+		DN:         dn,
+		Attributes: make(map[string][]string),
+	}
+}
+
+// AttributeNames returns the names of the attributes of the entry, sorted
+func (e Entry) AttributeNames() []string {
+	names := make([]string, 0, len(e.Attributes))
+	for name := range e.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e Entry) serializeDN() string {
+	return formatAttrValue("dn", e.DN) + "\n"
+}
+
+func (e Entry) serializeAttributes() string {
+	var builder strings.Builder
+	for _, name := range e.AttributeNames() {
+		for _, value := range e.Attributes[name] {
+			builder.WriteString(formatAttrValue(name, value) + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// String returns the entry in ldif format, without the trailing blank line
+func (e Entry) String() string {
+	return e.serializeDN() + e.serializeAttributes()
+}
+
+// Gets the entry attributes, as a string slice of ldif lines, sorted
+func (e Entry) getSortedAttributes() []string {
+	attributesAsStrings := make([]string, 0)
+	for k, vv := range e.Attributes {
+		for _, v := range vv {
+			attributesAsStrings = append(attributesAsStrings, formatAttrValue(k, v))
+		}
+	}
+	sort.Strings(attributesAsStrings)
+
+	return attributesAsStrings
+}
+
+// EntryList is a list of entries, sortable by dn
+type EntryList []Entry
+
+// Methods of the Interface interface for sorting based on dn
+func (l EntryList) Len() int {
+	return len(l)
+}
+
+// Sort order is hierarchical (see CompareDN), to have the parent entries before their children
+func (l EntryList) Less(i, j int) bool {
+	return CompareDN(l[i].DN, l[j].DN) < 0
+}
+
+func (l EntryList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+// Helper implementing the stringer interface
+func (l EntryList) String() string {
+	var builder strings.Builder
+	for _, entry := range l {
+		builder.WriteString(entry.serializeDN())
+		for _, nv := range entry.getSortedAttributes() {
+			builder.WriteString(nv + "\n")
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// ---------------------- End types
@@ -0,0 +1,143 @@
+package ldif
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reading of configurations split in several ldif files: fragments with the global configuration,
+// each database and each overlay, directories with them, or slapd.d directories
+
+// ErrDuplicateEntry is returned when an entry is in several files, or several times in a file, with
+// different attributes
+var ErrDuplicateEntry = errors.New("entry defined several times, with different attributes")
+
+// IsConfigDir returns whether the path is a slapd.d directory, with a cn=config.ldif file
+func IsConfigDir(path string) bool {
+	info, err := os.Stat(filepath.Join(path, "cn=config.ldif"))
+	return err == nil && !info.IsDir()
+}
+
+// ExpandPaths returns the ldif files in a list of files, directories and glob patterns, such as
+// conf/*.ldif. Directories are replaced by the .ldif files in them and their subdirectories, sorted
+// by name. It is an error if a path does not exist or a pattern does not match any file
+func ExpandPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		matches := []string{path}
+		if strings.ContainsAny(path, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(path); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no files found", path)
+			}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				files = append(files, match)
+				continue
+			}
+			var dirFiles []string
+			err = filepath.Walk(match, func(file string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() && strings.HasSuffix(file, ".ldif") {
+					dirFiles = append(dirFiles, file)
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(dirFiles)
+			files = append(files, dirFiles...)
+		}
+	}
+	return files, nil
+}
+
+// ReadFiles reads the entries of a list of files, directories and glob patterns (see ExpandPaths),
+// and merges them. slapd.d directories are read as in ReadConfigDir. An entry may be in several
+// files if it has the same attributes in all of them. Otherwise, an error wrapping ErrDuplicateEntry
+// is returned, with all the entries defined differently and their files
+func ReadFiles(paths []string, schema *Schema) (EntryList, error) {
+	type source struct {
+		entry Entry
+		files []string
+	}
+	sources := make(map[string]*source)
+	var keys []string
+	var conflicts []string
+
+	add := func(entries EntryList, file string) {
+		for _, entry := range entries {
+			key := dnKey(entry.DN)
+			s, found := sources[key]
+			if !found {
+				sources[key] = &source{entry: entry, files: []string{file}}
+				keys = append(keys, key)
+				continue
+			}
+			if !sameEntry(&s.entry, &entry, schema) {
+				conflicts = append(conflicts, fmt.Sprintf("%s in %s and %s", entry.DN, strings.Join(s.files, ", "), file))
+			}
+			s.files = append(s.files, file)
+		}
+	}
+
+	for _, path := range paths {
+		if IsConfigDir(path) {
+			entries, err := ReadConfigDir(path)
+			if err != nil {
+				return nil, err
+			}
+			add(entries, path)
+			continue
+		}
+
+		files, err := ExpandPaths([]string{path})
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			entries, err := readFile(file)
+			if err != nil {
+				return nil, err
+			}
+			add(entries, file)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateEntry, strings.Join(conflicts, "; "))
+	}
+
+	entries := make(EntryList, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, sources[key].entry)
+	}
+	sort.Sort(entries)
+	return entries, nil
+}
+
+func readFile(file string) (EntryList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return entries, nil
+}
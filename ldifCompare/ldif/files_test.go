@@ -0,0 +1,79 @@
+package ldif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fragments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"global.ldif":                 "dn: cn=config\nobjectClass: olcGlobal\ncn: config\n",
+		"databases/1-mdb.ldif":        "dn: olcDatabase={1}mdb,cn=config\nobjectClass: olcMdbConfig\nolcDatabase: {1}mdb\n",
+		"databases/2-monitor.ldif":    "dn: olcDatabase={2}monitor,cn=config\nobjectClass: olcDatabaseConfig\nolcDatabase: {2}monitor\n",
+		"databases/README":            "Not an ldif",
+		"overlays/syncprov.ldif":      "dn: olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config\nobjectClass: olcSyncProvConfig\nolcOverlay: {0}syncprov\n",
+		"overlays/same-global.ldif":   "dn: cn=config\ncn: config\nobjectClass: olcGlobal\n",
+		"conflict/other-global.ldif":  "dn: cn=config\nobjectClass: olcGlobal\ncn: config\nolcLogLevel: stats\n",
+		"conflict/other-monitor.ldif": "dn: olcDatabase={2}monitor,cn=config\nobjectClass: olcDatabaseConfig\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfigDir(t, filepath.Join(dir, "slapd.d"))
+
+	// A file, a directory and a glob. cn=config is in two files, with the same attributes
+	entries, err := ReadFiles([]string{
+		filepath.Join(dir, "global.ldif"),
+		filepath.Join(dir, "databases"),
+		filepath.Join(dir, "overlays", "*.ldif"),
+	}, DefaultSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dns []string
+	for _, entry := range entries {
+		dns = append(dns, entry.DN)
+	}
+	expected := "cn=config|olcDatabase={1}mdb,cn=config|olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config|olcDatabase={2}monitor,cn=config"
+	if strings.Join(dns, "|") != expected {
+		t.Errorf("Bad entries read: %v", dns)
+	}
+
+	// slapd.d directories are read with the DNs of the tree
+	entries, err = ReadFiles([]string{filepath.Join(dir, "slapd.d")}, DefaultSchema())
+	if err != nil || len(entries) != 3 || entries[2].DN != "olcOverlay={0}ppolicy,olcDatabase={1}mdb,cn=config" {
+		t.Errorf("Bad slapd.d read: %v %v", err, entries)
+	}
+
+	// Entries with different attributes in several files
+	_, err = ReadFiles([]string{dir + "/global.ldif", dir + "/databases", dir + "/conflict"}, DefaultSchema())
+	if !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("Expected ErrDuplicateEntry, got %v", err)
+	}
+	for _, part := range []string{"cn=config in " + dir + "/global.ldif and " + dir + "/conflict/other-global.ldif",
+		"olcDatabase={2}monitor,cn=config in " + dir + "/databases/2-monitor.ldif and " + dir + "/conflict/other-monitor.ldif"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("Missing conflict %s in %v", part, err)
+		}
+	}
+
+	if _, err := ReadFiles([]string{filepath.Join(dir, "*.missing")}, DefaultSchema()); err == nil {
+		t.Errorf("Expected error for a pattern without files")
+	}
+}
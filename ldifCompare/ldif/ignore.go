@@ -0,0 +1,102 @@
+package ldif
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// IgnoreRule removes an attribute from the entries before comparing them. Attribute is the
+// name of the attribute, and DNPattern, if not empty, restricts the rule to the entries under the
+// DNs that match it. Both are glob patterns (see path.Match) and are matched ignoring case
+type IgnoreRule struct {
+	Attribute string
+	DNPattern string
+}
+
+// IgnoreRules is a list of rules, applied to both sides of the comparison
+type IgnoreRules []IgnoreRule
+
+// DefaultIgnoreRules returns the rules to ignore the operational attributes in all entries
+func DefaultIgnoreRules() IgnoreRules {
+	rules := make(IgnoreRules, 0, len(OperationalAttributes))
+	for _, name := range OperationalAttributes {
+		rules = append(rules, IgnoreRule{Attribute: name})
+	}
+	return rules
+}
+
+// ParseIgnoreRule parses a rule in the form "<attribute> [under <dn pattern>]", for instance
+// "olcDbDirectory under olcDatabase=*,cn=config"
+func ParseIgnoreRule(text string) (IgnoreRule, error) {
+	fields := strings.Fields(text)
+	switch {
+	case len(fields) == 1:
+		return IgnoreRule{Attribute: fields[0]}, nil
+	case len(fields) > 2 && strings.EqualFold(fields[1], "under"):
+		return IgnoreRule{Attribute: fields[0], DNPattern: strings.Join(fields[2:], " ")}, nil
+	default:
+		return IgnoreRule{}, fmt.Errorf("invalid ignore rule %q. Expected <attribute> [under <dn pattern>]", text)
+	}
+}
+
+// ParseIgnoreRules reads rules, one per line. Blank lines and lines starting with # are skipped
+func ParseIgnoreRules(r io.Reader) (IgnoreRules, error) {
+	rules := make(IgnoreRules, 0)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rule, err := ParseIgnoreRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Whether the rule applies to the attribute in an entry. The entry is under the pattern if the
+// pattern matches its normalized DN or the one of any of its ancestors
+func (rule IgnoreRule) matches(attribute string, dn DN) bool {
+	if matched, _ := path.Match(strings.ToLower(rule.Attribute), strings.ToLower(attribute)); !matched {
+		return false
+	}
+	if rule.DNPattern == "" {
+		return true
+	}
+	pattern := strings.ToLower(rule.DNPattern)
+	for ancestor := dn; len(ancestor) > 0; ancestor = ancestor.Parent() {
+		if matched, _ := path.Match(pattern, ancestor.Normalized()); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply removes the ignored attributes from the entries
+func (rules IgnoreRules) Apply(entries EntryList) {
+	if len(rules) == 0 {
+		return
+	}
+	for _, entry := range entries {
+		dn, err := ParseDN(entry.DN)
+		if err != nil {
+			dn = DN{}
+		}
+		for name := range entry.Attributes {
+			for _, rule := range rules {
+				if rule.matches(name, dn) {
+					delete(entry.Attributes, name)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	entries, _ := Parse(strings.NewReader(`
+dn: cn=config
+olcPidFile: /var/run/slapd.pid
+entryCSN: 20211024101010.123456Z#000000#000#000000
+modifyTimestamp: 20211024101010Z
+
+dn: olcDatabase={1}mdb,cn=config
+olcDbDirectory: /var/lib/ldap
+olcDbMaxSize: 1073741824
+
+dn: olcOverlay={0}ppolicy,olcDatabase={1}mdb,cn=config
+olcDbDirectory: /var/lib/other
+`))
+
+	rules, err := ParseIgnoreRules(strings.NewReader(`
+# Local paths
+olcDbDirectory under olcDatabase=*,cn=config
+olcPid*
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	append(DefaultIgnoreRules(), rules...).Apply(entries)
+
+	expected := `dn: cn=config
+
+dn: olcDatabase={1}mdb,cn=config
+olcDbMaxSize: 1073741824
+
+dn: olcOverlay={0}ppolicy,olcDatabase={1}mdb,cn=config
+
+`
+	if entries.String() != expected {
+		t.Fatalf("Bad entries after ignoring attributes:\n%s", entries)
+	}
+
+	if _, err := ParseIgnoreRules(strings.NewReader("olcDbDirectory\nolcDbDirectory in cn=config\n")); err == nil || !strings.HasPrefix(err.Error(), "line 2") {
+		t.Fatal("Expected error in line 2 but got", err)
+	}
+}
@@ -0,0 +1,309 @@
+package ldif
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Validation of ldif files, with entries or change records, before they are used. All the problems
+// are reported, instead of stopping at the first one as Parse does
+
+// Severity of a problem found by Lint
+type Severity string
+
+// Severities. Errors make the ldif unusable, or not what was intended. Warnings may be fine
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is an issue found by Lint, at the line where the record, or the offending line, starts
+type Problem struct {
+	Line     int
+	DN       string
+	Severity Severity
+	Message  string
+}
+
+// String describes the problem in a line
+func (p Problem) String() string {
+	if p.DN == "" {
+		return fmt.Sprintf("line %d: %s: %s", p.Line, p.Severity, p.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s: %s", p.Line, p.Severity, p.DN, p.Message)
+}
+
+// LintOptions configures the checks. Schema is used to compare values and names. If Defined is not
+// nil, the attributes not defined in it are reported as warnings. The values in the problems are
+// redacted with Redaction
+type LintOptions struct {
+	Schema    *Schema
+	Defined   *Schema
+	Redaction Redaction
+}
+
+// A record being checked, with its entry or change
+type lintRecord struct {
+	line   int
+	entry  Entry
+	change *ChangeRecord
+}
+
+// Lint checks an ldif with entries or, if any record has a changetype, change records. It reports
+// parse errors, invalid DNs, duplicate values, gaps in the {n} indexes of ordered values and, for
+// entries, duplicate DNs, entries without objectClass and entries whose parent is missing when
+// some other ancestor is present. The returned error is only for errors reading the input
+func Lint(r io.Reader, options LintOptions) ([]Problem, error) {
+	linter := &linter{options: options}
+
+	var records [][]ldifLine
+	reader := newRecordReader(r)
+	isChanges := false
+	for {
+		record, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		var parseError *ParseError
+		if errors.As(err, &parseError) {
+			linter.report(parseError.Line, "", SeverityError, "%s: %s", parseError.Err, options.Redaction.Line(parseError.Text, options.Schema))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range record {
+			if strings.HasPrefix(strings.ToLower(line.text), "changetype:") {
+				isChanges = true
+			}
+		}
+		records = append(records, record)
+	}
+
+	var parsed []lintRecord
+	for _, record := range records {
+		if lint, ok := linter.parse(record, isChanges); ok {
+			parsed = append(parsed, lint)
+		}
+	}
+
+	for _, record := range parsed {
+		linter.checkDN(record)
+		if record.change == nil {
+			linter.checkAttributes(record.line, record.entry.DN, record.entry.Attributes, true)
+			if len(record.entry.Attributes[entryAttributeName(&record.entry, "objectClass", options.Schema)]) == 0 {
+				linter.report(record.line, record.entry.DN, SeverityError, "entry without objectClass")
+			}
+			continue
+		}
+		switch record.change.ChangeType {
+		case ChangeAdd:
+			linter.checkAttributes(record.line, record.change.DN, record.change.Attributes, true)
+			entry := Entry{DN: record.change.DN, Attributes: record.change.Attributes}
+			if len(entry.Attributes[entryAttributeName(&entry, "objectClass", options.Schema)]) == 0 {
+				linter.report(record.line, record.change.DN, SeverityError, "entry without objectClass")
+			}
+		case ChangeModify:
+			for _, mod := range record.change.Modifications {
+				// Only replace has all the values, and their indexes
+				linter.checkAttributes(record.line, record.change.DN, map[string][]string{mod.Attribute: mod.Values}, mod.Type == ModReplace)
+			}
+		}
+	}
+	if !isChanges {
+		linter.checkTree(parsed)
+	}
+
+	sort.SliceStable(linter.problems, func(i, j int) bool {
+		return linter.problems[i].Line < linter.problems[j].Line
+	})
+	return linter.problems, nil
+}
+
+type linter struct {
+	options  LintOptions
+	problems []Problem
+}
+
+func (l *linter) report(line int, dn string, severity Severity, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{Line: line, DN: dn, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+// Parses a record as an entry or a change. Records without dn are reported, except the comments
+// that were left alone
+func (l *linter) parse(record []ldifLine, isChanges bool) (lintRecord, bool) {
+	lint := lintRecord{line: record[0].number}
+	if attr, _, err := parseAttrValue(record[0]); err == nil && !strings.EqualFold(attr, "dn") {
+		l.report(lint.line, "", SeverityError, "record without dn: %s", l.options.Redaction.Line(record[0].text, l.options.Schema))
+		return lint, false
+	}
+
+	var err error
+	if isChanges {
+		var change ChangeRecord
+		change, err = parseChangeRecord(record)
+		lint.change = &change
+		lint.entry.DN = change.DN
+	} else {
+		lint.entry, err = parseRecord(record)
+	}
+
+	var parseError *ParseError
+	switch {
+	case errors.As(err, &parseError):
+		l.report(parseError.Line, lint.entry.DN, SeverityError, "%s: %s", parseError.Err, l.options.Redaction.Line(parseError.Text, l.options.Schema))
+		return lint, false
+	case err != nil:
+		l.report(lint.line, lint.entry.DN, SeverityError, "%s", err)
+		return lint, false
+	}
+	return lint, true
+}
+
+func (l *linter) checkDN(record lintRecord) {
+	if _, err := ParseDN(record.entry.DN); err != nil {
+		l.report(record.line, record.entry.DN, SeverityError, "invalid DN: %s", err)
+	}
+	if record.change != nil && record.change.ChangeType == ChangeModRDN {
+		if _, err := ParseDN(record.change.NewRDN); err != nil {
+			l.report(record.line, record.entry.DN, SeverityError, "invalid newrdn %q: %s", record.change.NewRDN, err)
+		}
+		if _, err := ParseDN(record.change.NewSuperior); err != nil {
+			l.report(record.line, record.entry.DN, SeverityError, "invalid newsuperior %q: %s", record.change.NewSuperior, err)
+		}
+	}
+}
+
+// Checks the values of the attributes: duplicates, gaps in {n} indexes if all the values are there,
+// and attributes not defined
+func (l *linter) checkAttributes(line int, dn string, attributes map[string][]string, checkIndexes bool) {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := attributes[name]
+		if l.options.Defined != nil {
+			if _, found := l.options.Defined.Lookup(name); !found {
+				l.report(line, dn, SeverityWarning, "attribute %s not defined in the schema", name)
+			}
+		}
+
+		seen := make(map[string]bool)
+		for _, v := range values {
+			normalized := l.options.Schema.NormalizeValue(name, v)
+			if seen[normalized] {
+				l.report(line, dn, SeverityError, "duplicate value in %s: %s", name, l.options.Redaction.Value(name, v, l.options.Schema))
+			}
+			seen[normalized] = true
+		}
+
+		// The index of the values in the RDN, as olcDatabase, is checked with the siblings
+		if checkIndexes && isOrderedAttribute(values, nil) && !isRDNAttribute(dn, name, l.options.Schema) {
+			indexes := make([]int, len(values))
+			for i, v := range values {
+				indexes[i], _, _ = splitOrderedValue(v)
+			}
+			if message := indexGaps(indexes); message != "" {
+				l.report(line, dn, SeverityWarning, "%s in %s", message, name)
+			}
+		}
+	}
+}
+
+// Whether the attribute is in the RDN of the DN
+func isRDNAttribute(dn string, name string, schema *Schema) bool {
+	parsed, err := ParseDN(dn)
+	if err != nil || len(parsed) == 0 {
+		return false
+	}
+	for _, atav := range parsed[0] {
+		if schema.AttributeKey(atav.Type) == schema.AttributeKey(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a description of the problems in a list of {n} indexes, which should be 0 to n-1, or "".
+// The frontend database is {-1}
+func indexGaps(indexes []int) string {
+	sorted := append([]int{}, indexes...)
+	sort.Ints(sorted)
+	expected := 0
+	if len(sorted) > 0 && sorted[0] == -1 {
+		expected = -1
+	}
+	for i, index := range sorted {
+		if i > 0 && index == sorted[i-1] {
+			return fmt.Sprintf("repeated index {%d}", index)
+		}
+		if index != expected {
+			return fmt.Sprintf("index {%d} missing", expected)
+		}
+		expected++
+	}
+	return ""
+}
+
+// Checks the entries as a tree: duplicate DNs, orphans and gaps in the {n} indexes of the RDNs of siblings
+func (l *linter) checkTree(records []lintRecord) {
+	byKey := make(map[string]lintRecord)
+	for _, record := range records {
+		key := dnKey(record.entry.DN)
+		if first, found := byKey[key]; found {
+			l.report(record.line, record.entry.DN, SeverityError, "duplicate DN, first defined at line %d", first.line)
+			continue
+		}
+		byKey[key] = record
+	}
+
+	// Indexes of the ordered RDNs, by parent and attribute
+	type siblings struct {
+		line    int
+		parent  string
+		name    string
+		indexes []int
+	}
+	ordered := make(map[string]*siblings)
+	var orderedKeys []string
+
+	for _, record := range records {
+		dn, err := ParseDN(record.entry.DN)
+		if err != nil || len(dn) == 0 || byKey[dnKey(record.entry.DN)].line != record.line {
+			continue
+		}
+		if _, found := byKey[dnKey(dn.Parent().String())]; !found {
+			for ancestor := dn.Parent(); len(ancestor) > 0; ancestor = ancestor.Parent() {
+				if _, found := byKey[dnKey(ancestor.String())]; found {
+					l.report(record.line, record.entry.DN, SeverityError, "parent %s does not exist", dn.Parent())
+					break
+				}
+			}
+		}
+
+		// Siblings are only checked when their parent is present, as the file may have only some of them
+		if _, found := byKey[dnKey(dn.Parent().String())]; found && len(dn[0]) == 1 {
+			if index, _, ok := splitOrderedValue(dn[0][0].Value); ok {
+				key := dnKey(dn.Parent().String()) + "\x00" + l.options.Schema.AttributeKey(dn[0][0].Type)
+				if ordered[key] == nil {
+					ordered[key] = &siblings{line: record.line, parent: dn.Parent().String(), name: dn[0][0].Type}
+					orderedKeys = append(orderedKeys, key)
+				}
+				ordered[key].indexes = append(ordered[key].indexes, index)
+			}
+		}
+	}
+
+	for _, key := range orderedKeys {
+		s := ordered[key]
+		if message := indexGaps(s.indexes); message != "" {
+			l.report(s.line, s.parent, SeverityWarning, "%s in %s of the children", message, s.name)
+		}
+	}
+}
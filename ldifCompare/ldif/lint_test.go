@@ -0,0 +1,131 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	content := `version: 1
+
+dn: cn=config
+objectClass: olcGlobal
+cn: config
+
+dn: olcDatabase={-1}frontend,cn=config
+objectClass: olcDatabaseConfig
+olcDatabase: {-1}frontend
+
+dn: olcDatabase={0}config,cn=config
+objectClass: olcDatabaseConfig
+olcDatabase: {0}config
+olcRootPW: secret
+olcRootPW: secret
+olcAccess: {0}to * by * none
+olcAccess: {2}to * by * read
+
+dn: olcDatabase={2}mdb,cn=config
+olcDatabase: {2}mdb
+olcUnknown: value
+
+dn: olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config
+objectClass: olcSyncProvConfig
+
+dn: olcDatabase={0}config,cn=config
+objectClass: olcDatabaseConfig
+
+dn: cn=bad,,cn=config
+objectClass: top
+
+olcLogLevel: stats
+
+dn: cn=wrong,cn=config
+objectClass: top
+description:: not base64!
+
+dn: dc=example,dc=com
+objectClass: domain
+`
+	schema := NewSchema()
+	for _, name := range []string{"objectClass", "cn", "olcDatabase", "olcRootPW", "olcAccess", "dc", "description"} {
+		schema.Add(&AttributeType{Names: []string{name}})
+	}
+
+	problems, err := Lint(strings.NewReader(content), LintOptions{Schema: DefaultSchema(), Defined: schema, Redaction: DefaultRedaction()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, problem := range problems {
+		lines = append(lines, problem.String())
+	}
+	expected := []string{
+		"line 11: error: olcDatabase={0}config,cn=config: duplicate value in olcRootPW: ********",
+		"line 11: warning: olcDatabase={0}config,cn=config: index {1} missing in olcAccess",
+		"line 19: warning: olcDatabase={2}mdb,cn=config: attribute olcUnknown not defined in the schema",
+		"line 19: error: olcDatabase={2}mdb,cn=config: entry without objectClass",
+		"line 23: error: olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config: parent olcDatabase={1}mdb,cn=config does not exist",
+		"line 26: error: olcDatabase={0}config,cn=config: duplicate DN, first defined at line 11",
+		"line 29: error: cn=bad,,cn=config: invalid DN: ",
+		"line 32: error: record without dn: olcLogLevel: stats",
+		"line 36: error: cn=wrong,cn=config: invalid value: bad base64 encoding: ",
+	}
+	if len(lines) != len(expected)+1 {
+		t.Errorf("Expected %d problems, got:\n%s", len(expected)+1, strings.Join(lines, "\n"))
+	}
+	all := strings.Join(lines, "\n")
+	for _, line := range expected {
+		if !strings.Contains(all, line) {
+			t.Errorf("Missing problem: %s\nin\n%s", line, all)
+		}
+	}
+	if !strings.Contains(all, "index {1} missing in olcDatabase of the children") {
+		t.Errorf("Missing gap in RDNs\n%s", all)
+	}
+	if strings.Contains(all, "secret") {
+		t.Errorf("Secret not redacted\n%s", all)
+	}
+}
+
+func TestLintChanges(t *testing.T) {
+	changes := `
+dn: olcDatabase={1}mdb,cn=config
+changetype: modify
+delete: olcAccess
+olcAccess: {3}
+-
+replace: olcDbIndex
+olcDbIndex: uid eq
+olcDbIndex: UID eq
+
+dn: cn=new,ou=missing,dc=example,dc=com
+changetype: add
+cn: new
+
+dn: cn=old,dc=example,dc=com
+changetype: modrdn
+newrdn: old
+deleteoldrdn: 1
+`
+	problems, err := Lint(strings.NewReader(changes), LintOptions{Schema: DefaultSchema()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, problem := range problems {
+		lines = append(lines, problem.String())
+	}
+	all := strings.Join(lines, "\n")
+	for _, line := range []string{
+		"line 2: error: olcDatabase={1}mdb,cn=config: duplicate value in olcDbIndex: UID eq",
+		"line 11: error: cn=new,ou=missing,dc=example,dc=com: entry without objectClass",
+		"line 15: error: cn=old,dc=example,dc=com: invalid newrdn",
+	} {
+		if !strings.Contains(all, line) {
+			t.Errorf("Missing problem: %s\nin\n%s", line, all)
+		}
+	}
+	if len(problems) != 3 {
+		t.Errorf("Expected 3 problems, got\n%s", all)
+	}
+}
@@ -0,0 +1,233 @@
+package ldif
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Three-way merge of configurations. The changes between the last applied configuration (base) and
+// the desired one are applied to the live one, keeping the changes made live since then
+
+// ErrConflict is returned by Merge when there are conflicts and the policy is MergeFail
+var ErrConflict = errors.New("conflicting changes")
+
+// MergePolicy selects how conflicts, changes of the same attribute or entry in both sides, are resolved
+type MergePolicy int
+
+// Merge policies
+const (
+	// Conflicts are an error
+	MergeFail MergePolicy = iota
+	// The live values are kept
+	MergePreferLive
+	// The desired values are applied
+	MergePreferDesired
+)
+
+var mergePolicyNames = map[string]MergePolicy{
+	"fail":    MergeFail,
+	"live":    MergePreferLive,
+	"desired": MergePreferDesired,
+}
+
+// ParseMergePolicy converts the name of a merge policy (fail, live or desired) to its value
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	if policy, found := mergePolicyNames[strings.ToLower(name)]; found {
+		return policy, nil
+	}
+	return MergeFail, fmt.Errorf("unknown merge policy %q", name)
+}
+
+// Conflict is an attribute, or a whole entry if Attribute is empty, changed in different ways in
+// the live and desired configurations. The values are nil if the attribute or entry does not exist
+type Conflict struct {
+	DN        string
+	Attribute string
+	Base      []string
+	Live      []string
+	Desired   []string
+}
+
+// String describes the conflict in a line
+func (c Conflict) String() string {
+	if c.Attribute == "" {
+		return fmt.Sprintf("%s: entry %s live and %s in desired configuration", c.DN, describeEntryChange(c.Base, c.Live), describeEntryChange(c.Base, c.Desired))
+	}
+	return fmt.Sprintf("%s: %s changed live to %s and in desired configuration to %s (was %s)", c.DN, c.Attribute,
+		describeValues(c.Live), describeValues(c.Desired), describeValues(c.Base))
+}
+
+func describeEntryChange(base []string, side []string) string {
+	switch {
+	case base == nil:
+		return "added"
+	case side == nil:
+		return "deleted"
+	default:
+		return "modified"
+	}
+}
+
+func describeValues(values []string) string {
+	if len(values) == 0 {
+		return "(none)"
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+// Merge returns the configuration with the changes from base to desired applied to live. When an
+// attribute has been changed in both sides, in different ways, the policy decides which values are
+// kept. Entries are matched by DN, and attributes as a whole, using the schema to compare the values
+// All the conflicts are returned, and, with MergeFail, an error wrapping ErrConflict
+func Merge(base EntryList, live EntryList, desired EntryList, policy MergePolicy, schema *Schema) (EntryList, []Conflict, error) {
+	baseSet := newEntrySet(base)
+	liveSet := newEntrySet(live)
+	desiredSet := newEntrySet(desired)
+
+	keys := make(map[string]bool)
+	for _, set := range []entrySet{baseSet, liveSet, desiredSet} {
+		for key := range set {
+			keys[key] = true
+		}
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	merged := make(EntryList, 0, len(sortedKeys))
+	conflicts := make([]Conflict, 0)
+	for _, key := range sortedKeys {
+		b, l, d := baseSet[key], liveSet[key], desiredSet[key]
+
+		var result *Entry
+		switch {
+		case b == nil && (l == nil || d == nil):
+			// Added in one side
+			result = l
+			if result == nil {
+				result = d
+			}
+		case b != nil && l == nil && d == nil:
+			// Deleted in both sides
+		case l == nil || d == nil:
+			// Deleted in one side. It is a conflict if the other one has changed it
+			other := l
+			if other == nil {
+				other = d
+			}
+			if !sameEntry(b, other, schema) {
+				conflict := Conflict{DN: b.DN, Base: []string{}}
+				if l != nil {
+					conflict.Live = []string{}
+				}
+				if d != nil {
+					conflict.Desired = []string{}
+				}
+				conflicts = append(conflicts, conflict)
+				if policy == MergePreferLive {
+					result = l
+				} else {
+					result = d
+				}
+			}
+		default:
+			// Changed, or added, in both sides
+			if b == nil {
+				b = &Entry{DN: d.DN, Attributes: map[string][]string{}}
+			}
+			var entryConflicts []Conflict
+			result, entryConflicts = mergeEntry(b, l, d, policy, schema)
+			conflicts = append(conflicts, entryConflicts...)
+		}
+
+		if result != nil {
+			merged = append(merged, *result)
+		}
+	}
+
+	sort.Sort(merged)
+	if len(conflicts) > 0 && policy == MergeFail {
+		return merged, conflicts, fmt.Errorf("%w: %d conflicts", ErrConflict, len(conflicts))
+	}
+	return merged, conflicts, nil
+}
+
+// Merges the attributes of an entry present in live and desired. The DN is the desired one
+func mergeEntry(base *Entry, live *Entry, desired *Entry, policy MergePolicy, schema *Schema) (*Entry, []Conflict) {
+	var conflicts []Conflict
+	result := NewEntry(desired.DN)
+
+	baseAttributes, baseNames := foldAttributes(*base, schema)
+	liveAttributes, liveNames := foldAttributes(*live, schema)
+	desiredAttributes, desiredNames := foldAttributes(*desired, schema)
+
+	// Names are written as in the desired configuration, if present there
+	names := make(map[string]string)
+	for _, n := range []map[string]string{baseNames, liveNames, desiredNames} {
+		for key, name := range n {
+			names[key] = name
+		}
+	}
+
+	for _, key := range unionOfKeys(names, nil) {
+		name := names[key]
+		b, l, d := baseAttributes[key], liveAttributes[key], desiredAttributes[key]
+
+		var values []string
+		switch {
+		case sameValues(name, d, b, schema):
+			values = l
+		case sameValues(name, l, b, schema), sameValues(name, l, d, schema):
+			values = d
+		default:
+			conflicts = append(conflicts, Conflict{DN: desired.DN, Attribute: name, Base: nonNil(b), Live: nonNil(l), Desired: nonNil(d)})
+			if policy == MergePreferLive {
+				values = l
+			} else {
+				values = d
+			}
+		}
+
+		if len(values) > 0 {
+			result.Attributes[name] = append([]string{}, values...)
+		}
+	}
+
+	return &result, conflicts
+}
+
+// Whether two entries have the same attributes and values
+func sameEntry(a *Entry, b *Entry, schema *Schema) bool {
+	_, changed := diffEntry(*a, *b, Options{Replace: ReplaceNever, Schema: schema})
+	return !changed
+}
+
+// Whether two lists of values of an attribute are equal, using the schema. Ordered values are
+// compared in order, and any others as sets
+func sameValues(name string, a []string, b []string, schema *Schema) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if isOrderedAttribute(a, b) {
+		a, b = sortOrderedValues(a), sortOrderedValues(b)
+		for i := range a {
+			if schema.NormalizeValue(name, a[i]) != schema.NormalizeValue(name, b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	added, deleted := diffValues(name, a, b, schema)
+	return len(added) == 0 && len(deleted) == 0
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,130 @@
+package ldif
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	base := `
+dn: cn=config
+olcLogLevel: stats
+olcIdleTimeout: 0
+olcThreads: 16
+
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcDbIndex: objectClass eq
+olcAccess: {0}to * by * read
+
+dn: olcDatabase={2}monitor,cn=config
+olcDatabase: {2}monitor
+
+dn: cn=unchanged,cn=config
+cn: unchanged
+`
+	// Live changes: olcLogLevel and olcIdleTimeout, a new index and a deleted entry
+	live := `
+dn: cn=config
+olcLogLevel: sync
+olcIdleTimeout: 30
+olcThreads: 16
+
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcDbIndex: objectClass eq
+olcDbIndex: uid eq
+olcAccess: {0}to * by * read
+
+dn: cn=unchanged,cn=config
+cn: unchanged
+
+dn: cn=live,cn=config
+cn: live
+`
+	// Desired changes: olcLogLevel (conflict), olcIdleTimeout (same as live), olcThreads, olcAccess,
+	// and the monitor database, deleted live
+	desired := `
+dn: cn=config
+olcLogLevel: none
+olcIdleTimeout: 30
+olcThreads: 8
+
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcDbIndex: objectClass eq
+olcAccess: {0}to * by self write
+olcAccess: {1}to * by * read
+
+dn: olcDatabase={2}monitor,cn=config
+olcDatabase: {2}monitor
+olcMonitoring: TRUE
+
+dn: cn=unchanged,cn=config
+cn: unchanged
+`
+	baseEntries, _ := Parse(strings.NewReader(base))
+	liveEntries, _ := Parse(strings.NewReader(live))
+	desiredEntries, _ := Parse(strings.NewReader(desired))
+
+	_, conflicts, err := Merge(baseEntries, liveEntries, desiredEntries, MergeFail, DefaultSchema())
+	if !errors.Is(err, ErrConflict) || len(conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %v: %v", err, conflicts)
+	}
+	if conflicts[0].String() != "cn=config: olcLogLevel changed live to [sync] and in desired configuration to [none] (was [stats])" {
+		t.Errorf("Bad conflict: %s", conflicts[0])
+	}
+	if conflicts[1].String() != "olcDatabase={2}monitor,cn=config: entry deleted live and modified in desired configuration" {
+		t.Errorf("Bad conflict: %s", conflicts[1])
+	}
+
+	expected := `dn: cn=config
+olcIdleTimeout: 30
+olcLogLevel: sync
+olcThreads: 8
+
+dn: cn=live,cn=config
+cn: live
+
+dn: cn=unchanged,cn=config
+cn: unchanged
+
+dn: olcDatabase={1}mdb,cn=config
+olcAccess: {0}to * by self write
+olcAccess: {1}to * by * read
+olcDatabase: {1}mdb
+olcDbIndex: objectClass eq
+olcDbIndex: uid eq
+
+`
+	merged, _, err := Merge(baseEntries, liveEntries, desiredEntries, MergePreferLive, DefaultSchema())
+	if err != nil || merged.String() != expected {
+		t.Errorf("Bad merge preferring live: %v\n%s", err, merged)
+	}
+
+	merged, _, err = Merge(baseEntries, liveEntries, desiredEntries, MergePreferDesired, DefaultSchema())
+	changes := FormatChanges(Diff(merged, liveEntries))
+	expectedChanges := `dn: cn=config
+changetype: modify
+replace: olcLogLevel
+olcLogLevel: none
+-
+replace: olcThreads
+olcThreads: 8
+
+dn: olcDatabase={1}mdb,cn=config
+changetype: modify
+add: olcAccess
+olcAccess: {0}to * by self write
+
+dn: olcDatabase={2}monitor,cn=config
+changetype: add
+olcDatabase: {2}monitor
+olcMonitoring: TRUE
+
+`
+	if err != nil || changes != expectedChanges {
+		t.Errorf("Bad changes preferring desired: %v\n%s", err, changes)
+	}
+}
@@ -0,0 +1,174 @@
+package ldif
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReplaceMode selects which changed attributes are written as a replace: modification,
+// instead of a delete: of the old values followed by an add: of the new ones
+type ReplaceMode int
+
+// Replace modes. Attributes are only replaced if they have values in both sides
+const (
+	// Known single valued attributes, such as olcSuffix or olcLogLevel, are replaced
+	ReplaceKnown ReplaceMode = iota
+	// Known single valued attributes, and attributes with one value in each side, are replaced
+	ReplaceSingle
+	// All changed attributes are replaced
+	ReplaceAll
+	// Values are always deleted and added
+	ReplaceNever
+)
+
+var replaceModeNames = map[string]ReplaceMode{
+	"known":  ReplaceKnown,
+	"single": ReplaceSingle,
+	"all":    ReplaceAll,
+	"never":  ReplaceNever,
+}
+
+// ParseReplaceMode converts the name of a replace mode (known, single, all or never) to its value
+func ParseReplaceMode(name string) (ReplaceMode, error) {
+	if mode, found := replaceModeNames[strings.ToLower(name)]; found {
+		return mode, nil
+	}
+	return ReplaceKnown, fmt.Errorf("unknown replace mode %q", name)
+}
+
+// Options modifies the way the changes are generated
+// Schema is used to compare attribute names and values. A nil schema compares values byte by byte
+// Renames are applied to the current entries with a modrdn. Current entries not in the target are
+// also renamed to a new target entry if the similarity of their attributes, not counting the RDN,
+// is at least RenameSimilarity, from 0 to 1. 0 disables the detection of renames
+type Options struct {
+	Replace          ReplaceMode
+	Schema           *Schema
+	Renames          []Rename
+	RenameSimilarity float64
+}
+
+// DefaultOptions returns the options used by Diff
+func DefaultOptions() Options {
+	return Options{
+		Replace: ReplaceKnown,
+		Schema:  DefaultSchema(),
+	}
+}
+
+// Whether the changes of the attribute are to be written as a replace:
+func (o Options) useReplace(name string, targetValues []string, currentValues []string) bool {
+	if len(targetValues) == 0 || len(currentValues) == 0 {
+		return false
+	}
+	switch o.Replace {
+	case ReplaceAll:
+		return true
+	case ReplaceSingle:
+		return o.isSingleValued(name) || (len(targetValues) == 1 && len(currentValues) == 1)
+	case ReplaceKnown:
+		return o.isSingleValued(name)
+	default:
+		return false
+	}
+}
+
+// Single valued attributes are those in the known list, or defined as SINGLE-VALUE in the schema
+func (o Options) isSingleValued(name string) bool {
+	if attributeType, found := o.Schema.Lookup(name); found && attributeType.SingleValue {
+		return true
+	}
+	return IsSingleValued(name)
+}
+
+// IsSingleValued returns true for the cn=config attributes that hold a single value, and for which
+// slapd does not accept, or does not apply atomically, a delete followed by an add
+func IsSingleValued(name string) bool {
+	return singleValuedAttributes[strings.ToLower(name)]
+}
+
+// Single valued attributes of cn=config, in lowercase
+var singleValuedAttributes = map[string]bool{
+	// Global configuration
+	"olcargsfile":                      true,
+	"olcauthzpolicy":                   true,
+	"olcconcurrency":                   true,
+	"olcconfigdir":                     true,
+	"olcconfigfile":                    true,
+	"olcconnmaxpending":                true,
+	"olcconnmaxpendingauth":            true,
+	"olcgentlehup":                     true,
+	"olcidletimeout":                   true,
+	"olcindexhash64":                   true,
+	"olcindexintlen":                   true,
+	"olcindexsubstranylen":             true,
+	"olcindexsubstranystep":            true,
+	"olcindexsubstrifmaxlen":           true,
+	"olcindexsubstrifminlen":           true,
+	"olclistenerthreads":               true,
+	"olclocalssf":                      true,
+	"olclogfile":                       true,
+	"olcloglevel":                      true,
+	"olcmaxfilterdepth":                true,
+	"olcpasswordcryptsaltformat":       true,
+	"olcpidfile":                       true,
+	"olcreverselookup":                 true,
+	"olcsaslauxprops":                  true,
+	"olcsaslauxpropsdontusecopyignore": true,
+	"olcsaslhost":                      true,
+	"olcsaslrealm":                     true,
+	"olcsaslsecprops":                  true,
+	"olcsockbufmaxincoming":            true,
+	"olcsockbufmaxincomingauth":        true,
+	"olcthreadqueues":                  true,
+	"olcthreads":                       true,
+	"olctlscacertificatefile":          true,
+	"olctlscacertificatepath":          true,
+	"olctlscertificatefile":            true,
+	"olctlscertificatekeyfile":         true,
+	"olctlsciphersuite":                true,
+	"olctlscrlcheck":                   true,
+	"olctlscrlfile":                    true,
+	"olctlsdhparamfile":                true,
+	"olctlsecname":                     true,
+	"olctlsprotocolmin":                true,
+	"olctlsrandfile":                   true,
+	"olctlsverifyclient":               true,
+	"olctoolthreads":                   true,
+	"olcwritetimeout":                  true,
+	// Databases
+	"olcaddcontentacl":   true,
+	"olchidden":          true,
+	"olclastbind":        true,
+	"olclastmod":         true,
+	"olcmaxderefdepth":   true,
+	"olcmirrormode":      true,
+	"olcmonitoring":      true,
+	"olcmultiprovider":   true,
+	"olcreadonly":        true,
+	"olcrootdn":          true,
+	"olcrootpw":          true,
+	"olcschemadn":        true,
+	"olcsuffix":          true,
+	"olcsyncusesubentry": true,
+	"olcupdatedn":        true,
+	// mdb backend
+	"olcdbcheckpoint":   true,
+	"olcdbdirectory":    true,
+	"olcdbmaxentrysize": true,
+	"olcdbmaxreaders":   true,
+	"olcdbmaxsize":      true,
+	"olcdbmode":         true,
+	"olcdbnosync":       true,
+	"olcdbrtxnsize":     true,
+	"olcdbsearchstack":  true,
+	// Overlays
+	"olcaccesslogdb":          true,
+	"olcppolicydefault":       true,
+	"olcppolicyhashcleartext": true,
+	"olcppolicyuselockout":    true,
+	"olcspcheckpoint":         true,
+	"olcspnopresent":          true,
+	"olcspreloadhint":         true,
+	"olcspsessionlog":         true,
+}
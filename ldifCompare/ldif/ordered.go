@@ -0,0 +1,324 @@
+package ldif
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Support for the ordered values used in cn=config (X-ORDERED), where each value, or the RDN value
+// of sibling entries, is prefixed by its position in the form {n}
+
+// Splits an ordered value in its index and the value without the prefix. The last return
+// value is false if the value has no {n} prefix
+func splitOrderedValue(value string) (int, string, bool) {
+	if !strings.HasPrefix(value, "{") {
+		return 0, value, false
+	}
+	end := strings.IndexByte(value, '}')
+	if end < 2 {
+		return 0, value, false
+	}
+	index, err := strconv.Atoi(value[1:end])
+	if err != nil {
+		return 0, value, false
+	}
+	return index, value[end+1:], true
+}
+
+// Returns the value with the specified index prefix
+func orderedValue(index int, value string) string {
+	return fmt.Sprintf("{%d}%s", index, value)
+}
+
+// Whether all the values of the attribute, in both sides, have a {n} prefix
+func isOrderedAttribute(targetValues []string, currentValues []string) bool {
+	if len(targetValues) == 0 && len(currentValues) == 0 {
+		return false
+	}
+	for _, values := range [][]string{targetValues, currentValues} {
+		for _, v := range values {
+			if _, _, ok := splitOrderedValue(v); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns the values without the prefix, sorted by index
+func sortOrderedValues(values []string) []string {
+	sorted := sortedByIndex(values)
+	for i, v := range sorted {
+		_, sorted[i], _ = splitOrderedValue(v)
+	}
+	return sorted
+}
+
+// Returns a copy of the values, sorted by index
+func sortedByIndex(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _, _ := splitOrderedValue(sorted[i])
+		b, _, _ := splitOrderedValue(sorted[j])
+		return a < b
+	})
+	return sorted
+}
+
+// Returns, for each element in a and b, whether it is part of a longest common subsequence of both
+func longestCommonSubsequence(a []string, b []string) ([]bool, []bool) {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	inA := make([]bool, len(a))
+	inB := make([]bool, len(b))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			inA[i] = true
+			inB[j] = true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return inA, inB
+}
+
+// Generates the modifications for an ordered attribute. The values not to be kept are deleted
+// by index, highest first so that the remaining indexes are not affected, and then the new values
+// are added in their final position, lowest first
+// Values are compared using the equality matching rule of the attribute
+func diffOrderedValues(name string, targetValues []string, currentValues []string, schema *Schema) []Modification {
+	var mods []Modification
+
+	target := sortOrderedValues(targetValues)
+	current := sortOrderedValues(currentValues)
+	keepTarget, keepCurrent := longestCommonSubsequence(normalizeValues(name, target, schema), normalizeValues(name, current, schema))
+
+	for i := len(current) - 1; i >= 0; i-- {
+		if !keepCurrent[i] {
+			mods = append(mods, Modification{Type: ModDelete, Attribute: name, Values: []string{orderedValue(i, "")}})
+		}
+	}
+	for i, v := range target {
+		if !keepTarget[i] {
+			mods = append(mods, Modification{Type: ModAdd, Attribute: name, Values: []string{orderedValue(i, v)}})
+		}
+	}
+
+	return mods
+}
+
+func normalizeValues(name string, values []string, schema *Schema) []string {
+	normalized := make([]string, len(values))
+	for i, v := range values {
+		normalized[i] = schema.NormalizeValue(name, v)
+	}
+	return normalized
+}
+
+// An entry being compared, with the DN it had in the input, before any renames
+type workingEntry struct {
+	Entry
+	originalDN string
+}
+
+// Detects the entries whose RDN is an ordered value that has been renumbered, such as
+// olcDatabase={1}mdb becoming olcDatabase={2}mdb when another database is inserted before it.
+// Returns the modrdn records, in an order in which they can be applied, and the current entries
+// with the DNs they will have after the renames
+func detectOrderedRenames(targetLdif EntryList, currentLdif EntryList) ([]ChangeRecord, []workingEntry) {
+	renames := make([]ChangeRecord, 0)
+
+	working := make([]workingEntry, len(currentLdif))
+	maxDepth := 0
+	for i, entry := range currentLdif {
+		working[i] = workingEntry{Entry: entry, originalDN: entry.DN}
+		if depth := len(dnSortKey(entry.DN)); depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+
+	// Parents are processed before their children, so that the children are grouped using the
+	// already renamed DN of their parent
+	for depth := 1; depth <= maxDepth; depth++ {
+		targetGroups := groupOrderedSiblings(targetLdif, depth)
+		currentGroups := groupOrderedSiblings(workingEntries(working), depth)
+
+		for _, key := range sortedKeys(currentGroups) {
+			currentGroup := currentGroups[key]
+			targetGroup, found := targetGroups[key]
+			if !found {
+				continue
+			}
+
+			keepTarget, keepCurrent := longestCommonSubsequence(bareRDNValues(targetGroup), bareRDNValues(currentGroup))
+			var pairs [][2]orderedSibling
+			t := 0
+			for c := range currentGroup {
+				if !keepCurrent[c] {
+					continue
+				}
+				for !keepTarget[t] {
+					t++
+				}
+				if currentGroup[c].index != targetGroup[t].index {
+					pairs = append(pairs, [2]orderedSibling{currentGroup[c], targetGroup[t]})
+				}
+				t++
+			}
+
+			// Entries moving to a lower index are renamed first, lowest first, and then those moving
+			// to a higher index, highest first, so that the new name is never in use
+			sort.SliceStable(pairs, func(i, j int) bool {
+				iDown := pairs[i][1].index < pairs[i][0].index
+				jDown := pairs[j][1].index < pairs[j][0].index
+				if iDown != jDown {
+					return iDown
+				}
+				if iDown {
+					return pairs[i][0].index < pairs[j][0].index
+				}
+				return pairs[i][0].index > pairs[j][0].index
+			})
+
+			for _, pair := range pairs {
+				renames = append(renames, renameWorkingEntries(working, pair[0], pair[1]))
+			}
+		}
+	}
+
+	return renames, working
+}
+
+// A sibling entry whose RDN is an ordered value
+type orderedSibling struct {
+	dn        string
+	rdnType   string
+	rdnValue  string
+	index     int
+	bareValue string
+}
+
+// Groups the entries at the specified depth whose RDN is a single ordered value, by parent DN and
+// RDN attribute type. Each group is sorted by index
+func groupOrderedSiblings(entries EntryList, depth int) map[string][]orderedSibling {
+	groups := make(map[string][]orderedSibling)
+	for _, entry := range entries {
+		dn, err := ParseDN(entry.DN)
+		if err != nil || len(dn) != depth || len(dn[0]) != 1 {
+			continue
+		}
+		index, bareValue, ok := splitOrderedValue(dn[0][0].Value)
+		if !ok {
+			continue
+		}
+		key := dn.Parent().Normalized() + "|" + strings.ToLower(dn[0][0].Type)
+		groups[key] = append(groups[key], orderedSibling{
+			dn:        entry.DN,
+			rdnType:   dn[0][0].Type,
+			rdnValue:  dn[0][0].Value,
+			index:     index,
+			bareValue: normalizeDNValue(bareValue),
+		})
+	}
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].index < group[j].index })
+	}
+	return groups
+}
+
+func bareRDNValues(group []orderedSibling) []string {
+	values := make([]string, len(group))
+	for i, sibling := range group {
+		values[i] = sibling.bareValue
+	}
+	return values
+}
+
+func workingEntries(working []workingEntry) EntryList {
+	entries := make(EntryList, len(working))
+	for i, w := range working {
+		entries[i] = w.Entry
+	}
+	return entries
+}
+
+func sortedKeys(groups map[string][]orderedSibling) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Changes the DN of the renamed entry and its descendants in the working entries, and returns
+// the corresponding modrdn record
+func renameWorkingEntries(working []workingEntry, from orderedSibling, to orderedSibling) ChangeRecord {
+	newRDN := RDN{{Type: from.rdnType, Value: to.rdnValue}}.String()
+
+	fromDN, _ := ParseDN(from.dn)
+	fromKey := fromDN.Normalized()
+	newDN := append(DN{{{Type: from.rdnType, Value: to.rdnValue}}}, fromDN.Parent()...)
+
+	for i := range working {
+		dn, err := ParseDN(working[i].DN)
+		if err != nil || len(dn) < len(fromDN) || dn[len(dn)-len(fromDN):].Normalized() != fromKey {
+			continue
+		}
+		renamed := append(DN{}, dn[:len(dn)-len(fromDN)]...)
+		working[i].DN = append(renamed, newDN...).String()
+
+		// The RDN attribute value changes as well in the renamed entry
+		if len(dn) == len(fromDN) {
+			attributes := make(map[string][]string, len(working[i].Attributes))
+			for name, values := range working[i].Attributes {
+				attributes[name] = values
+				if strings.EqualFold(name, from.rdnType) {
+					attributes[name] = replaceValue(values, from.rdnValue, to.rdnValue)
+				}
+			}
+			working[i].Attributes = attributes
+		}
+	}
+
+	return ChangeRecord{
+		DN:           from.dn,
+		ChangeType:   ChangeModRDN,
+		NewRDN:       newRDN,
+		DeleteOldRDN: true,
+	}
+}
+
+// Returns a copy of the values with the old value replaced by the new one
+func replaceValue(values []string, oldValue string, newValue string) []string {
+	replaced := make([]string, len(values))
+	for i, v := range values {
+		if v == oldValue {
+			replaced[i] = newValue
+		} else {
+			replaced[i] = v
+		}
+	}
+	return replaced
+}
@@ -0,0 +1,90 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffOrderedValues(t *testing.T) {
+	current := `
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcAccess: {0}to attrs=userPassword by self write
+olcAccess: {1}to dn.base="" by * read
+olcAccess: {2}to * by users read
+olcAccess: {3}to * by * none
+`
+	target := `
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcAccess: {0}to attrs=userPassword by self write
+olcAccess: {1}to dn.base="cn=Subschema" by * read
+olcAccess: {2}to dn.base="" by * read
+olcAccess: {3}to * by users read
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	changes := FormatChanges(Diff(targetEntries, currentEntries))
+	expected := `dn: olcDatabase={1}mdb,cn=config
+changetype: modify
+delete: olcAccess
+olcAccess: {3}
+-
+add: olcAccess
+olcAccess: {1}to dn.base="cn=Subschema" by * read
+
+`
+	if changes != expected {
+		t.Fatalf("Bad changes for ordered values:\n%s", changes)
+	}
+}
+
+func TestDiffRenumberedDatabase(t *testing.T) {
+	current := `
+dn: cn=config
+cn: config
+
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcSuffix: dc=example
+
+dn: olcOverlay={0}ppolicy,olcDatabase={1}mdb,cn=config
+olcOverlay: {0}ppolicy
+
+dn: olcDatabase={2}monitor,cn=config
+olcDatabase: {2}monitor
+`
+	target := `
+dn: cn=config
+cn: config
+
+dn: olcDatabase={1}hdb,cn=config
+olcDatabase: {1}hdb
+
+dn: olcDatabase={2}mdb,cn=config
+olcDatabase: {2}mdb
+olcSuffix: dc=example
+
+dn: olcOverlay={0}ppolicy,olcDatabase={2}mdb,cn=config
+olcOverlay: {0}ppolicy
+
+dn: olcDatabase={3}monitor,cn=config
+olcDatabase: {3}monitor
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	var order []string
+	for _, change := range Diff(targetEntries, currentEntries) {
+		order = append(order, string(change.ChangeType)+" "+change.DN+" "+change.NewRDN)
+	}
+	expected := []string{
+		"modrdn olcDatabase={2}monitor,cn=config olcDatabase={3}monitor",
+		"modrdn olcDatabase={1}mdb,cn=config olcDatabase={2}mdb",
+		"add olcDatabase={1}hdb,cn=config ",
+	}
+	if strings.Join(order, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Bad changes for renumbered databases:\n%s", strings.Join(order, "\n"))
+	}
+}
@@ -0,0 +1,312 @@
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Helpers to read and write LDIF as specified in RFC 2849
+
+// Kinds of parsing errors, to be checked with errors.Is
+var (
+	ErrInvalidLine        = errors.New("line not valid")
+	ErrDuplicateDN        = errors.New("entry with two dn")
+	ErrUnsupportedVersion = errors.New("unsupported ldif version")
+	ErrInvalidValue       = errors.New("invalid value")
+	ErrMissingDN          = errors.New("record without dn")
+)
+
+// ParseError is returned when the ldif could not be parsed. Line is the number of the
+// physical line where the offending logical line starts
+type ParseError struct {
+	Line int
+	Err  error
+	Text string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Err.Error(), e.Text)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse reads an ldif and generates an EntryList
+// The results are ordered by dn, parents before children
+// The format is the one specified in RFC 2849: base64 values, folded lines, file urls, version
+// header and CRLF line endings are accepted, and the values are returned as the raw bytes
+func Parse(r io.Reader) (EntryList, error) {
+
+	records, err := readRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ldapEntries := make(EntryList, 0)
+
+	// Iterate through entries
+	for _, record := range records {
+
+		currentEntry, err := parseRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		ldapEntries = append(ldapEntries, currentEntry)
+	}
+
+	// Sort the entries, parents first
+	sort.Sort(ldapEntries)
+
+	return ldapEntries, nil
+}
+
+// Reads the ldif and splits it in records, removing the version specification if present
+func readRecords(r io.Reader) ([][]ldifLine, error) {
+	records := make([][]ldifLine, 0)
+	reader := newRecordReader(r)
+	for {
+		record, err := reader.next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// Builds an entry from the lines in a record
+func parseRecord(record []ldifLine) (Entry, error) {
+
+	entry := NewEntry("")
+
+	for _, line := range record {
+
+		// A line MUST be of the form attrName: AttrValue-posibly-including other ":"
+		attr, value, err := parseAttrValue(line)
+		if err != nil {
+			return entry, err
+		}
+
+		if strings.EqualFold(attr, "dn") {
+			// Add the dn
+			if entry.DN != "" {
+				return entry, &ParseError{Line: line.number, Err: ErrDuplicateDN, Text: line.text}
+			}
+			entry.DN = value
+		} else {
+			// Add an attribute
+			entry.Attributes[attr] = append(entry.Attributes[attr], value)
+		}
+	}
+	if entry.DN == "" {
+		return entry, &ParseError{Line: record[0].number, Err: ErrMissingDN, Text: record[0].text}
+	}
+
+	return entry, nil
+}
+
+// A logical line, that is, a physical line with all its continuation lines appended
+// The line number is the one of the first physical line, for error reporting
+type ldifLine struct {
+	number int
+	text   string
+}
+
+// Reads the records of an ldif one by one. Each record is a slice of logical lines, where the folded
+// lines have already been unwrapped and comments removed. Both LF and CRLF line endings are accepted
+type recordReader struct {
+	reader     *bufio.Reader
+	lineNumber int
+	records    int
+}
+
+func newRecordReader(r io.Reader) *recordReader {
+	return &recordReader{reader: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Returns the next record, or io.EOF at the end of the input. The version specification, if present
+// at the beginning of the first record, is removed, and so is the search result at the end of the output
+// of ldapsearch
+func (r *recordReader) next() ([]ldifLine, error) {
+	for {
+		record, err := r.nextRecord()
+		if err != nil {
+			return nil, err
+		}
+		r.records++
+		if isSearchResult(record) {
+			continue
+		}
+		if r.records > 1 || !strings.HasPrefix(strings.ToLower(record[0].text), "version:") {
+			return record, nil
+		}
+		_, version, err := parseAttrValue(record[0])
+		if err != nil || strings.TrimSpace(version) != "1" {
+			return nil, &ParseError{Line: record[0].number, Err: ErrUnsupportedVersion, Text: record[0].text}
+		}
+		if len(record) > 1 {
+			return record[1:], nil
+		}
+	}
+}
+
+// Whether the record is the result that ldapsearch writes after the entries, as in "search: 2" and
+// "result: 0 Success"
+func isSearchResult(record []ldifLine) bool {
+	for _, line := range record {
+		switch strings.ToLower(line.text[:strings.IndexByte(line.text+":", ':')]) {
+		case "search", "result", "matcheddn", "text", "ref", "control":
+		default:
+			return false
+		}
+	}
+	return strings.HasPrefix(strings.ToLower(record[0].text), "search:")
+}
+
+func (r *recordReader) nextRecord() ([]ldifLine, error) {
+	var currentRecord []ldifLine
+
+	// Whether the last logical line was a comment, to discard also its continuation lines
+	isComment := false
+
+	for {
+		physicalLine, err := r.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if physicalLine == "" && err == io.EOF {
+			// Treat the possibly last record
+			if len(currentRecord) > 0 {
+				return currentRecord, nil
+			}
+			return nil, io.EOF
+		}
+		r.lineNumber++
+		if r.lineNumber == 1 {
+			physicalLine = stripBOM(physicalLine)
+		}
+		physicalLine = strings.TrimSuffix(strings.TrimSuffix(physicalLine, "\n"), "\r")
+
+		// Empty line. Marks the end of the record. A line with only spaces is a continuation line
+		if physicalLine == "" {
+			if len(currentRecord) > 0 {
+				return currentRecord, nil
+			}
+			isComment = false
+			continue
+		}
+
+		// Continuation line. The first space is removed, and the rest is appended to the previous line
+		if physicalLine[0] == ' ' {
+			if !isComment && len(currentRecord) > 0 {
+				currentRecord[len(currentRecord)-1].text += physicalLine[1:]
+			}
+			continue
+		}
+
+		// Comment
+		if physicalLine[0] == '#' {
+			isComment = true
+			continue
+		}
+
+		isComment = false
+		currentRecord = append(currentRecord, ldifLine{number: r.lineNumber, text: physicalLine})
+	}
+}
+
+// Parses a logical line of the form attrName: value, attrName:: base64Value or attrName:< url
+// and returns the attribute description and the raw value. Errors are of type *ParseError
+func parseAttrValue(line ldifLine) (string, string, error) {
+
+	colonPos := strings.Index(line.text, ":")
+	if colonPos < 1 {
+		return "", "", &ParseError{Line: line.number, Err: ErrInvalidLine, Text: line.text}
+	}
+	attr := line.text[:colonPos]
+	rest := line.text[colonPos+1:]
+
+	switch {
+	case strings.HasPrefix(rest, ":"):
+		// Base64 encoded value
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return "", "", &ParseError{Line: line.number, Err: fmt.Errorf("%w: bad base64 encoding: %s", ErrInvalidValue, err), Text: line.text}
+		}
+		return attr, string(decoded), nil
+
+	case strings.HasPrefix(rest, "<"):
+		// Value specified as an URL. Only file URLs are supported
+		value, err := readURLValue(strings.TrimLeft(rest[1:], " "))
+		if err != nil {
+			return "", "", &ParseError{Line: line.number, Err: fmt.Errorf("%w: %s", ErrInvalidValue, err), Text: line.text}
+		}
+		return attr, value, nil
+
+	default:
+		// Plain value. Only the leading spaces are not part of the value
+		return attr, strings.TrimLeft(rest, " "), nil
+	}
+}
+
+// Reads the contents of a file:// url
+func readURLValue(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	contents, err := ioutil.ReadFile(u.Path)
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+// Whether the value may be written as is in the ldif, or has to be base64 encoded (SAFE-STRING in RFC 2849)
+// Values ending with a space are also encoded, so that they survive trimming by other tools
+func isSafeString(value string) bool {
+	if value == "" {
+		return true
+	}
+	switch value[0] {
+	case ' ', ':', '<':
+		return false
+	}
+	if value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// Formats an attribute name and value as an ldif line, without the line terminator,
+// using base64 encoding if required
+func formatAttrValue(attr string, value string) string {
+	if isSafeString(value) {
+		return fmt.Sprintf("%s: %s", attr, value)
+	}
+	return fmt.Sprintf("%s:: %s", attr, base64.StdEncoding.EncodeToString([]byte(value)))
+}
+
+// Removes the byte order mark, if present
+func stripBOM(ldif string) string {
+	return strings.TrimPrefix(ldif, "\xef\xbb\xbf")
+}
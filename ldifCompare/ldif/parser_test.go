@@ -0,0 +1,117 @@
+package ldif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseLdifRFC2849(t *testing.T) {
+
+	// Value read through a file url
+	valueFile, err := ioutil.TempFile("", "ldifvalue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(valueFile.Name())
+	valueFile.WriteString("value from file")
+	valueFile.Close()
+
+	ldifText := "version: 1\r\n" +
+		"dn: cn=config\r\n" +
+		"objectClass: olcGlobal\r\n" +
+		"# A comment that is\r\n" +
+		"  folded\r\n" +
+		"olcTLSCipherSuite:: IGxlYWRpbmcgc3BhY2U=\r\n" +
+		"olcSaslRealm: folded\r\n" +
+		"  value\r\n" +
+		"description;lang-es:: w7FhbmR1\r\n" +
+		"olcConfigFile:< file://" + valueFile.Name() + "\r\n" +
+		"\r\n" +
+		"dn:: b2xjRGF0YWJhc2U9ezF9bWRiLGNuPWNvbmZpZw==\r\n" +
+		"olcDatabase: {1}mdb\r\n"
+
+	entries, err := Parse(strings.NewReader(ldifText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries but got %d", len(entries))
+	}
+
+	// Entries are sorted parents first
+	config := entries[0]
+	if config.DN != "cn=config" {
+		t.Fatal("Bad dn", config.DN)
+	}
+	if entries[1].DN != "olcDatabase={1}mdb,cn=config" {
+		t.Fatal("Bad base64 dn", entries[1].DN)
+	}
+
+	expected := map[string]string{
+		"objectClass":         "olcGlobal",
+		"olcTLSCipherSuite":   " leading space",
+		"olcSaslRealm":        "folded value",
+		"description;lang-es": "ñandu",
+		"olcConfigFile":       "value from file",
+	}
+	if len(config.Attributes) != len(expected) {
+		t.Fatalf("Unexpected attributes %v", config.Attributes)
+	}
+	for attr, value := range expected {
+		if len(config.Attributes[attr]) != 1 || config.Attributes[attr][0] != value {
+			t.Fatalf("Bad value for %s: %q", attr, config.Attributes[attr])
+		}
+	}
+
+	// Unsafe values are written back in base64
+	serialized := config.serializeAttributes()
+	if !strings.Contains(serialized, "olcTLSCipherSuite:: IGxlYWRpbmcgc3BhY2U=\n") {
+		t.Fatal("Value with leading space not encoded", serialized)
+	}
+	if !strings.Contains(serialized, "description;lang-es:: w7FhbmR1\n") {
+		t.Fatal("Non ascii value not encoded", serialized)
+	}
+}
+
+func TestParseWhitespaceLines(t *testing.T) {
+	// Lines with only spaces are continuation lines, not record separators
+	entries, err := Parse(strings.NewReader("dn: cn=config\ndescription: folded\n  \n \nolcLogLevel: stats\n\n# search result\nsearch: 2\nresult: 0 Success\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Attributes["description"][0] != "folded " || entries[0].Attributes["olcLogLevel"][0] != "stats" {
+		t.Fatalf("Bad entries %v", entries)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		ldif string
+		line int
+		err  error
+	}{
+		{"dn: cn=config\nno colon here\n", 2, ErrInvalidLine},
+		{"# comment\ndn: cn=config\ndn: cn=other\n", 3, ErrDuplicateDN},
+		{"version: 2\n\ndn: cn=config\n", 1, ErrUnsupportedVersion},
+		{"dn: cn=config\n\ndn: cn=other\ncn:: not base64!\n", 4, ErrInvalidValue},
+		{"dn: cn=config\ncn:< http://example.com/value\n", 2, ErrInvalidValue},
+		{"dn: cn=config\n\nolcLogLevel: stats\n", 3, ErrMissingDN},
+	}
+
+	for _, c := range cases {
+		_, err := Parse(strings.NewReader(c.ldif))
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			t.Fatalf("Expected ParseError for %q but got %v", c.ldif, err)
+		}
+		if parseError.Line != c.line {
+			t.Errorf("Expected error in line %d but got %d for %q", c.line, parseError.Line, c.ldif)
+		}
+		if !errors.Is(err, c.err) {
+			t.Errorf("Expected %v but got %v", c.err, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package ldif
+
+import (
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Redaction of secrets in the outputs read by people, or written to logs: debug traces, reports,
+// conflicts and errors. The change file has the real values, as it is applied
+
+// Redaction has the sensitive attributes, whose values are hidden, and the sensitive fields in
+// values with a list of name=value fields, such as credentials=... in olcSyncrepl
+type Redaction struct {
+	Attributes []string
+	Fields     []string
+}
+
+// RedactedValue is shown instead of the sensitive values
+const RedactedValue = "********"
+
+// DefaultRedaction returns the passwords and private keys in cn=config and in the entries
+func DefaultRedaction() Redaction {
+	return Redaction{
+		Attributes: []string{"olcRootPW", "userPassword", "olcDbACLPasswd", "olcTLSCertificateKeyFile"},
+		Fields:     []string{"credentials"},
+	}
+}
+
+// Matches a name=value field, where the value may be quoted
+func (r Redaction) fieldsExpression() *regexp.Regexp {
+	if len(r.Fields) == 0 {
+		return nil
+	}
+	names := make([]string, len(r.Fields))
+	for i, field := range r.Fields {
+		names[i] = regexp.QuoteMeta(field)
+	}
+	return regexp.MustCompile(`(?i)(^|[\s,}])(` + strings.Join(names, "|") + `)=("(?:[^"\\]|\\.)*"|\S*)`)
+}
+
+// IsSensitive returns whether the values of the attribute are hidden
+func (r Redaction) IsSensitive(name string, schema *Schema) bool {
+	key := schema.AttributeKey(name)
+	for _, attribute := range r.Attributes {
+		if schema.AttributeKey(attribute) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the value of the attribute, hidden if the attribute is sensitive, or with the
+// sensitive fields hidden
+func (r Redaction) Value(name string, value string, schema *Schema) string {
+	return r.value(name, value, schema, r.fieldsExpression())
+}
+
+func (r Redaction) value(name string, value string, schema *Schema, fields *regexp.Regexp) string {
+	if r.IsSensitive(name, schema) {
+		return RedactedValue
+	}
+	if fields != nil {
+		return fields.ReplaceAllString(value, "${1}${2}="+RedactedValue)
+	}
+	return value
+}
+
+// Values returns a copy of the values, redacted
+func (r Redaction) Values(name string, values []string, schema *Schema) []string {
+	return r.values(name, values, schema, r.fieldsExpression())
+}
+
+func (r Redaction) values(name string, values []string, schema *Schema, fields *regexp.Regexp) []string {
+	if values == nil {
+		return nil
+	}
+	redacted := make([]string, len(values))
+	for i, v := range values {
+		redacted[i] = r.value(name, v, schema, fields)
+	}
+	return redacted
+}
+
+// Entries returns a copy of the entries, with the values redacted
+func (r Redaction) Entries(entries EntryList, schema *Schema) EntryList {
+	fields := r.fieldsExpression()
+	redacted := make(EntryList, len(entries))
+	for i, entry := range entries {
+		redacted[i] = NewEntry(entry.DN)
+		for name, values := range entry.Attributes {
+			redacted[i].Attributes[name] = r.values(name, values, schema, fields)
+		}
+	}
+	return redacted
+}
+
+// Report returns a copy of the report, with the values redacted
+func (r Redaction) Report(report Report, schema *Schema) Report {
+	fields := r.fieldsExpression()
+	redacted := report
+	redacted.Changes = make([]ReportChange, len(report.Changes))
+	for i, change := range report.Changes {
+		redacted.Changes[i] = change
+		redacted.Changes[i].Attributes = make([]ReportAttribute, len(change.Attributes))
+		for j, attribute := range change.Attributes {
+			redacted.Changes[i].Attributes[j] = ReportAttribute{
+				Name:    attribute.Name,
+				Added:   r.values(attribute.Name, attribute.Added, schema, fields),
+				Removed: r.values(attribute.Name, attribute.Removed, schema, fields),
+			}
+		}
+	}
+	return redacted
+}
+
+// Conflict returns a copy of the conflict, with the values redacted
+func (r Redaction) Conflict(conflict Conflict, schema *Schema) Conflict {
+	redacted := conflict
+	redacted.Base = r.Values(conflict.Attribute, conflict.Base, schema)
+	redacted.Live = r.Values(conflict.Attribute, conflict.Live, schema)
+	redacted.Desired = r.Values(conflict.Attribute, conflict.Desired, schema)
+	return redacted
+}
+
+// Line returns an ldif line, attribute: value, with the value redacted
+func (r Redaction) Line(line string, schema *Schema) string {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return r.Value("", line, schema)
+	}
+	name := line[:colon]
+	if r.IsSensitive(name, schema) {
+		return name + ": " + RedactedValue
+	}
+	// base64 values are decoded to find the sensitive fields, and encoded again
+	if strings.HasPrefix(line[colon:], "::") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line[colon+2:]))
+		if err == nil {
+			return name + ":: " + base64.StdEncoding.EncodeToString([]byte(r.Value(name, string(decoded), schema)))
+		}
+	}
+	return name + r.Value(name, line[colon:], schema)
+}
+
+// Error returns the message of the error, with the line of the ldif redacted if it is, or wraps, a ParseError
+func (r Redaction) Error(err error, schema *Schema) string {
+	var parseError *ParseError
+	if !errors.As(err, &parseError) || parseError.Text == "" {
+		return err.Error()
+	}
+	return strings.Replace(err.Error(), parseError.Text, r.Line(parseError.Text, schema), 1)
+}
@@ -0,0 +1,49 @@
+package ldif
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	redaction := DefaultRedaction()
+	schema := DefaultSchema()
+
+	for _, test := range []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"olcRootPW", "secret", "********"},
+		{"olcrootpw", "{SSHA}abcd", "********"},
+		{"olcSuffix", "dc=example,dc=com", "dc=example,dc=com"},
+		{"olcSyncrepl", `{0}rid=001 provider=ldap://ldap1 bindmethod=simple credentials=secret searchbase="dc=example,dc=com"`,
+			`{0}rid=001 provider=ldap://ldap1 bindmethod=simple credentials=******** searchbase="dc=example,dc=com"`},
+		{"olcSyncrepl", `rid=001 credentials="a \"quoted\" secret" retry="5 +"`, `rid=001 credentials=******** retry="5 +"`},
+		{"olcDbIDAssertBind", `Credentials=secret bindmethod=simple`, `Credentials=******** bindmethod=simple`},
+		{"description", "nocredentials=here", "nocredentials=here"},
+	} {
+		if redacted := redaction.Value(test.name, test.value, schema); redacted != test.expected {
+			t.Errorf("Bad redaction of %s: %s\nexpected %s", test.name, redacted, test.expected)
+		}
+	}
+
+	entries, _ := Parse(strings.NewReader("dn: olcDatabase={0}config,cn=config\nolcRootPW: secret\nolcDatabase: {0}config\n"))
+	redacted := redaction.Entries(entries, schema)
+	if redacted[0].Attributes["olcRootPW"][0] != RedactedValue || entries[0].Attributes["olcRootPW"][0] != "secret" {
+		t.Errorf("Bad redaction of entries: %v", redacted)
+	}
+
+	// credentials=secret in base64
+	line := "olcSyncrepl:: " + base64.StdEncoding.EncodeToString([]byte("rid=001 credentials=secret"))
+	expected := "olcSyncrepl:: " + base64.StdEncoding.EncodeToString([]byte("rid=001 credentials=********"))
+	if redacted := redaction.Line(line, schema); redacted != expected {
+		t.Errorf("Bad redaction of base64 line: %s", redacted)
+	}
+
+	_, err := Parse(strings.NewReader("dn: cn=config\nolcRootPW:: not base64!\n"))
+	if message := redaction.Error(err, schema); err == nil || strings.Contains(message, "not base64") {
+		t.Errorf("Error not redacted: %s", message)
+	}
+}
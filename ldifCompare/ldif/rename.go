@@ -0,0 +1,259 @@
+package ldif
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Detection of renamed and moved entries. A modrdn is generated for them, instead of deleting the
+// entry and adding it again, which is not possible for entries with children
+
+// Rename maps the DN of an entry in the current ldif to its DN in the target ldif
+type Rename struct {
+	From string
+	To   string
+}
+
+// ParseRename parses a rename in the form "<current dn> => <target dn>"
+func ParseRename(text string) (Rename, error) {
+	parts := strings.Split(text, " => ")
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return Rename{}, fmt.Errorf("invalid rename %q. Expected <current dn> => <new dn>", text)
+	}
+	rename := Rename{From: strings.TrimSpace(parts[0]), To: strings.TrimSpace(parts[1])}
+	for _, dn := range []string{rename.From, rename.To} {
+		if _, err := ParseDN(dn); err != nil {
+			return Rename{}, fmt.Errorf("invalid rename %q: %w", text, err)
+		}
+	}
+	return rename, nil
+}
+
+// Returns the renames that undo the specified ones
+func reverseRenames(renames []Rename) []Rename {
+	reversed := make([]Rename, len(renames))
+	for i, rename := range renames {
+		reversed[i] = Rename{From: rename.To, To: rename.From}
+	}
+	return reversed
+}
+
+// Detects the current entries to be renamed, either because there is an explicit rename for them in
+// the options, or because they are similar enough to a new target entry (see Options.RenameSimilarity).
+// Returns the modrdn records, in the order in which they can be applied, and the current entries
+// with the DN and attributes they will have after the renames
+//
+// An entry is only renamed if its new DN is not in use and its new parent already exists, so the
+// renames can be applied before any other change. Entries whose RDN is an ordered value, such as
+// olcDatabase={1}mdb, are left to detectOrderedRenames
+func detectRenames(targetLdif EntryList, currentLdif EntryList, options Options) ([]ChangeRecord, EntryList) {
+	renames := make([]ChangeRecord, 0)
+	if len(options.Renames) == 0 && options.RenameSimilarity <= 0 {
+		return renames, currentLdif
+	}
+
+	// Entries are copied, as their attributes change
+	working := make(EntryList, len(currentLdif))
+	for i, entry := range currentLdif {
+		working[i] = *copyEntry(entry)
+	}
+
+	targetByKey := make(map[string]int, len(targetLdif))
+	for i, entry := range targetLdif {
+		targetByKey[dnKey(entry.DN)] = i
+	}
+	live := liveKeys(working)
+
+	rename := func(i int, to string) bool {
+		var target *Entry
+		if t, found := targetByKey[dnKey(to)]; found {
+			target = &targetLdif[t]
+		}
+		change, ok := moveWorkingEntries(working, live, i, to, target, options.Schema)
+		if ok {
+			renames = append(renames, change)
+			live = liveKeys(working)
+		}
+		return ok
+	}
+
+	// Explicit renames
+	for _, r := range options.Renames {
+		if i, found := live[dnKey(r.From)]; found {
+			rename(i, r.To)
+		}
+	}
+
+	if options.RenameSimilarity <= 0 {
+		return renames, working
+	}
+
+	// Renames by similarity. Parents are processed before their children, that may be already
+	// in place after renaming the parent
+	candidates := make([]int, len(working))
+	for i := range working {
+		candidates[i] = i
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(dnSortKey(working[candidates[i]].DN)) < len(dnSortKey(working[candidates[j]].DN))
+	})
+
+	var newTargets []int
+	targetPairs := make(map[int]map[string]bool)
+	for t, entry := range targetLdif {
+		if _, found := live[dnKey(entry.DN)]; !found && !hasOrderedRDN(entry.DN) {
+			newTargets = append(newTargets, t)
+			targetPairs[t] = attributePairs(entry, options.Schema)
+		}
+	}
+	claimed := make(map[int]bool)
+
+	for _, i := range candidates {
+		if _, found := targetByKey[dnKey(working[i].DN)]; found || hasOrderedRDN(working[i].DN) {
+			continue
+		}
+		pairs := attributePairs(working[i], options.Schema)
+
+		best, bestScore := -1, 0.0
+		for _, t := range newTargets {
+			if claimed[t] {
+				continue
+			}
+			if _, found := live[dnKey(targetLdif[t].DN)]; found {
+				continue
+			}
+			if score := jaccard(pairs, targetPairs[t]); score >= options.RenameSimilarity && score > bestScore {
+				best, bestScore = t, score
+			}
+		}
+		if best >= 0 && rename(i, targetLdif[best].DN) {
+			claimed[best] = true
+		}
+	}
+
+	return renames, working
+}
+
+// Returns the position of each working entry, by DN key
+func liveKeys(working EntryList) map[string]int {
+	live := make(map[string]int, len(working))
+	for i, entry := range working {
+		live[dnKey(entry.DN)] = i
+	}
+	return live
+}
+
+// Renames the working entry i, and its descendants, to the new DN, and returns the modrdn record
+// The old RDN values are kept if they are in the target entry. Returns false if the rename is not
+// possible: the new DN is in use, the new parent does not exist or is under the entry itself
+func moveWorkingEntries(working EntryList, live map[string]int, i int, to string, target *Entry, schema *Schema) (ChangeRecord, bool) {
+	fromDN, err := ParseDN(working[i].DN)
+	if err != nil || len(fromDN) == 0 {
+		return ChangeRecord{}, false
+	}
+	toDN, err := ParseDN(to)
+	if err != nil || len(toDN) == 0 {
+		return ChangeRecord{}, false
+	}
+
+	fromKey := dnKey(working[i].DN)
+	toKey := dnKey(to)
+	if _, found := live[toKey]; found || strings.HasPrefix(toKey, fromKey+"\x00") {
+		return ChangeRecord{}, false
+	}
+	newParent := toDN.Parent()
+	if _, found := live[dnKey(newParent.String())]; len(newParent) > 0 && !found {
+		return ChangeRecord{}, false
+	}
+
+	deleteOldRDN := true
+	if target != nil {
+		deleteOldRDN = false
+		for _, atav := range fromDN[0] {
+			name := entryAttributeName(target, atav.Type, schema)
+			if indexOfValue(name, target.Attributes[name], atav.Value, schema) < 0 {
+				deleteOldRDN = true
+			}
+		}
+	}
+
+	change := ChangeRecord{
+		DN:           working[i].DN,
+		ChangeType:   ChangeModRDN,
+		NewRDN:       toDN[0].String(),
+		DeleteOldRDN: deleteOldRDN,
+	}
+	if newParent.Normalized() != fromDN.Parent().Normalized() {
+		change.NewSuperior = newParent.String()
+	}
+
+	changeRDNAttributes(&working[i], fromDN[0], toDN[0], deleteOldRDN, schema)
+	for j := range working {
+		key := dnKey(working[j].DN)
+		if key != fromKey && !strings.HasPrefix(key, fromKey+"\x00") {
+			continue
+		}
+		dn, err := ParseDN(working[j].DN)
+		if err != nil {
+			continue
+		}
+		working[j].DN = append(append(DN{}, dn[:len(dn)-len(fromDN)]...), toDN...).String()
+	}
+
+	return change, true
+}
+
+// Whether any of the values in the RDN of the DN has a {n} prefix
+func hasOrderedRDN(dn string) bool {
+	parsed, err := ParseDN(dn)
+	if err != nil || len(parsed) == 0 {
+		return false
+	}
+	for _, atav := range parsed[0] {
+		if _, _, ok := splitOrderedValue(atav.Value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the attribute values of the entry, normalized, as attribute key and value pairs. The
+// values in the RDN are not included, as they are expected to change in a rename
+func attributePairs(entry Entry, schema *Schema) map[string]bool {
+	var rdn RDN
+	if dn, err := ParseDN(entry.DN); err == nil && len(dn) > 0 {
+		rdn = dn[0]
+	}
+
+	pairs := make(map[string]bool)
+	for name, values := range entry.Attributes {
+		key := schema.AttributeKey(name)
+	values:
+		for _, v := range values {
+			normalized := schema.NormalizeValue(name, v)
+			for _, atav := range rdn {
+				if schema.AttributeKey(atav.Type) == key && schema.NormalizeValue(name, atav.Value) == normalized {
+					continue values
+				}
+			}
+			pairs[key+"\x00"+normalized] = true
+		}
+	}
+	return pairs
+}
+
+// Similarity of two sets, from 0 (nothing in common, or both empty) to 1 (equal)
+func jaccard(a map[string]bool, b map[string]bool) float64 {
+	common := 0
+	for pair := range a {
+		if b[pair] {
+			common++
+		}
+	}
+	union := len(a) + len(b) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
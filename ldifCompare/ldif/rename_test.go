@@ -0,0 +1,124 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffRenames(t *testing.T) {
+	current := `
+dn: dc=example,dc=com
+dc: example
+
+dn: ou=people,dc=example,dc=com
+ou: people
+
+dn: ou=staff,dc=example,dc=com
+ou: staff
+
+dn: uid=jdoe,ou=people,dc=example,dc=com
+objectClass: inetOrgPerson
+uid: jdoe
+cn: John Doe
+sn: Doe
+mail: jdoe@example.com
+
+dn: ou=old,dc=example,dc=com
+objectClass: organizationalUnit
+ou: old
+description: Applications
+
+dn: cn=app,ou=old,dc=example,dc=com
+cn: app
+`
+	target := `
+dn: dc=example,dc=com
+dc: example
+
+dn: ou=people,dc=example,dc=com
+ou: people
+
+dn: ou=staff,dc=example,dc=com
+ou: staff
+
+dn: uid=jdoe,ou=staff,dc=example,dc=com
+objectClass: inetOrgPerson
+uid: jdoe
+cn: John Doe
+sn: Doe
+mail: john.doe@example.com
+
+dn: ou=apps,dc=example,dc=com
+objectClass: organizationalUnit
+ou: apps
+description: Applications
+
+dn: cn=app,ou=apps,dc=example,dc=com
+cn: app
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	// Without rename detection, the entry with children can not be deleted
+	changes := FormatChanges(Diff(targetEntries, currentEntries))
+	if !strings.Contains(changes, "dn: ou=old,dc=example,dc=com\nchangetype: delete\n") {
+		t.Errorf("Expected delete without rename detection:\n%s", changes)
+	}
+
+	options := DefaultOptions()
+	options.RenameSimilarity = 0.5
+	expected := `dn: ou=old,dc=example,dc=com
+changetype: modrdn
+newrdn: ou=apps
+deleteoldrdn: 1
+
+dn: uid=jdoe,ou=people,dc=example,dc=com
+changetype: modrdn
+newrdn: uid=jdoe
+deleteoldrdn: 0
+newsuperior: ou=staff,dc=example,dc=com
+
+dn: uid=jdoe,ou=staff,dc=example,dc=com
+changetype: modify
+delete: mail
+mail: jdoe@example.com
+-
+add: mail
+mail: john.doe@example.com
+
+`
+	changes = FormatChanges(DiffWithOptions(targetEntries, currentEntries, options))
+	if changes != expected {
+		t.Errorf("Bad renames:\n%s", changes)
+	}
+
+	// With a higher similarity, only the entries that are otherwise equal are renamed
+	options.RenameSimilarity = 1
+	changes = FormatChanges(DiffWithOptions(targetEntries, currentEntries, options))
+	if !strings.HasPrefix(changes, "dn: ou=old,dc=example,dc=com\nchangetype: modrdn\nnewrdn: ou=apps\n") ||
+		!strings.Contains(changes, "dn: uid=jdoe,ou=people,dc=example,dc=com\nchangetype: delete\n") {
+		t.Errorf("Bad renames with similarity 1:\n%s", changes)
+	}
+
+	// Explicit renames, and their rollback
+	options = DefaultOptions()
+	rename, err := ParseRename("uid=jdoe,ou=people,dc=example,dc=com => uid=jdoe,ou=staff,dc=example,dc=com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.Renames = []Rename{rename}
+	changes = FormatChanges(DiffWithOptions(targetEntries, currentEntries, options))
+	if !strings.HasPrefix(changes, "dn: uid=jdoe,ou=people,dc=example,dc=com\nchangetype: modrdn\nnewrdn: uid=jdoe\ndeleteoldrdn: 0\nnewsuperior: ou=staff,dc=example,dc=com\n") {
+		t.Errorf("Bad explicit rename:\n%s", changes)
+	}
+	rollback := FormatChanges(Rollback(targetEntries, currentEntries, options))
+	if !strings.HasPrefix(rollback, "dn: uid=jdoe,ou=staff,dc=example,dc=com\nchangetype: modrdn\nnewrdn: uid=jdoe\ndeleteoldrdn: 0\nnewsuperior: ou=people,dc=example,dc=com\n") {
+		t.Errorf("Bad rollback of explicit rename:\n%s", rollback)
+	}
+
+	for _, invalid := range []string{"cn=a", "cn=a => ", "cn=a => b"} {
+		if _, err := ParseRename(invalid); err == nil {
+			t.Errorf("Expected error parsing rename %q", invalid)
+		}
+	}
+}
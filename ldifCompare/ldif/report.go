@@ -0,0 +1,252 @@
+package ldif
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Structured description of a list of changes, for review tools, written as json or yaml.
+// The fields and their names are stable; new fields may be added, but existing ones are not
+// renamed or removed without changing ReportVersion
+
+// ReportVersion is the version of the report format
+const ReportVersion = 1
+
+// Report describes the changes, with the values added and removed in each entry
+type Report struct {
+	Version int            `json:"version"`
+	Summary ReportSummary  `json:"summary"`
+	Changes []ReportChange `json:"changes"`
+}
+
+// ReportSummary has the number of entries affected by each kind of change
+type ReportSummary struct {
+	Added    int `json:"added"`
+	Deleted  int `json:"deleted"`
+	Modified int `json:"modified"`
+	Renamed  int `json:"renamed"`
+}
+
+// ReportChange is a change record. NewDN is only set for modrdn
+type ReportChange struct {
+	DN         string            `json:"dn"`
+	Operation  ChangeType        `json:"operation"`
+	NewDN      string            `json:"newDN,omitempty"`
+	Attributes []ReportAttribute `json:"attributes"`
+}
+
+// ReportAttribute has the values of an attribute added and removed by a change. Ordered values
+// are reported with the index they have before (removed) or after (added) the change, and values
+// that only change their index are not reported
+type ReportAttribute struct {
+	Name    string   `json:"name"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// NewReport builds the report of the changes, to be applied to the current entries. The values
+// removed by each change are found by applying the changes to a copy of the entries
+func NewReport(changes []ChangeRecord, current EntryList, options Options) (Report, error) {
+	report := Report{Version: ReportVersion, Changes: make([]ReportChange, 0, len(changes))}
+
+	set := newEntrySet(current)
+	for i, change := range changes {
+		var before *Entry
+		if entry := set.lookup(change.DN); entry != nil {
+			before = copyEntry(*entry)
+		}
+		if err := set.apply(change, options.Schema); err != nil {
+			return report, fmt.Errorf("change %d (%s %s): %w", i+1, change.ChangeType, change.DN, err)
+		}
+
+		reportChange := ReportChange{DN: change.DN, Operation: change.ChangeType}
+		after := set.lookup(change.DN)
+		switch change.ChangeType {
+		case ChangeAdd:
+			report.Summary.Added++
+		case ChangeDelete:
+			report.Summary.Deleted++
+		case ChangeModify:
+			report.Summary.Modified++
+		case ChangeModRDN:
+			report.Summary.Renamed++
+			reportChange.NewDN = renamedDN(change)
+			after = set.lookup(reportChange.NewDN)
+		}
+		reportChange.Attributes = diffAttributes(before, after, options.Schema)
+		report.Changes = append(report.Changes, reportChange)
+	}
+
+	return report, nil
+}
+
+// Returns the DN of the entry after a modrdn
+func renamedDN(change ChangeRecord) string {
+	dn, err := ParseDN(change.DN)
+	if err != nil {
+		return change.NewRDN
+	}
+	parent := dn.Parent().String()
+	if change.NewSuperior != "" {
+		parent = change.NewSuperior
+	}
+	if parent == "" {
+		return change.NewRDN
+	}
+	return change.NewRDN + "," + parent
+}
+
+// Returns the values added and removed in each attribute, sorted by name. Any of the entries may be nil
+func diffAttributes(before *Entry, after *Entry, schema *Schema) []ReportAttribute {
+	names := make(map[string]string)
+	for _, entry := range []*Entry{before, after} {
+		if entry == nil {
+			continue
+		}
+		for name := range entry.Attributes {
+			names[schema.AttributeKey(name)] = name
+		}
+	}
+
+	attributes := make([]ReportAttribute, 0, len(names))
+	for _, name := range names {
+		var beforeValues, afterValues []string
+		if before != nil {
+			beforeValues = before.Attributes[entryAttributeName(before, name, schema)]
+		}
+		if after != nil {
+			afterValues = after.Attributes[entryAttributeName(after, name, schema)]
+		}
+
+		attribute := ReportAttribute{Name: name, Added: make([]string, 0), Removed: make([]string, 0)}
+		if len(beforeValues) > 0 && len(afterValues) > 0 && isOrderedAttribute(beforeValues, afterValues) {
+			// Values that are only renumbered are not reported
+			beforeSorted := sortedByIndex(beforeValues)
+			afterSorted := sortedByIndex(afterValues)
+			keepAfter, keepBefore := longestCommonSubsequence(
+				normalizeValues(name, sortOrderedValues(afterSorted), schema),
+				normalizeValues(name, sortOrderedValues(beforeSorted), schema))
+			for i, v := range beforeSorted {
+				if !keepBefore[i] {
+					attribute.Removed = append(attribute.Removed, v)
+				}
+			}
+			for i, v := range afterSorted {
+				if !keepAfter[i] {
+					attribute.Added = append(attribute.Added, v)
+				}
+			}
+		} else {
+			for _, v := range beforeValues {
+				if indexOfValue(name, afterValues, v, schema) < 0 {
+					attribute.Removed = append(attribute.Removed, v)
+				}
+			}
+			for _, v := range afterValues {
+				if indexOfValue(name, beforeValues, v, schema) < 0 {
+					attribute.Added = append(attribute.Added, v)
+				}
+			}
+		}
+
+		if len(attribute.Added) > 0 || len(attribute.Removed) > 0 {
+			attributes = append(attributes, attribute)
+		}
+	}
+
+	sort.Slice(attributes, func(i, j int) bool {
+		return strings.ToLower(attributes[i].Name) < strings.ToLower(attributes[j].Name)
+	})
+	return attributes
+}
+
+// JSON returns the report in json format, indented
+func (r Report) JSON() string {
+	return marshalJSON(r)
+}
+
+// YAML returns the report in yaml format, with the same fields as in json
+func (r Report) YAML() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "version: %d\n", r.Version)
+	builder.WriteString("summary:\n")
+	builder.WriteString(indentLines(r.Summary.YAML(), "  "))
+	if len(r.Changes) == 0 {
+		builder.WriteString("changes: []\n")
+		return builder.String()
+	}
+	builder.WriteString("changes:\n")
+	for _, change := range r.Changes {
+		fmt.Fprintf(&builder, "  - dn: %s\n", yamlString(change.DN))
+		fmt.Fprintf(&builder, "    operation: %s\n", change.Operation)
+		if change.NewDN != "" {
+			fmt.Fprintf(&builder, "    newDN: %s\n", yamlString(change.NewDN))
+		}
+		if len(change.Attributes) == 0 {
+			builder.WriteString("    attributes: []\n")
+			continue
+		}
+		builder.WriteString("    attributes:\n")
+		for _, attribute := range change.Attributes {
+			fmt.Fprintf(&builder, "      - name: %s\n", yamlString(attribute.Name))
+			writeYAMLList(&builder, "        added", attribute.Added)
+			writeYAMLList(&builder, "        removed", attribute.Removed)
+		}
+	}
+	return builder.String()
+}
+
+// String returns the summary as text
+func (s ReportSummary) String() string {
+	return fmt.Sprintf("Entries added: %d\nEntries deleted: %d\nEntries modified: %d\nEntries renamed: %d\n",
+		s.Added, s.Deleted, s.Modified, s.Renamed)
+}
+
+// JSON returns the summary in json format, indented
+func (s ReportSummary) JSON() string {
+	return marshalJSON(s)
+}
+
+// YAML returns the summary in yaml format
+func (s ReportSummary) YAML() string {
+	return fmt.Sprintf("added: %d\ndeleted: %d\nmodified: %d\nrenamed: %d\n", s.Added, s.Deleted, s.Modified, s.Renamed)
+}
+
+func writeYAMLList(builder *strings.Builder, key string, values []string) {
+	if len(values) == 0 {
+		builder.WriteString(key + ": []\n")
+		return
+	}
+	builder.WriteString(key + ":\n")
+	indent := strings.Repeat(" ", len(key)-len(strings.TrimLeft(key, " ")))
+	for _, v := range values {
+		builder.WriteString(indent + "  - " + yamlString(v) + "\n")
+	}
+}
+
+// Strings are always double quoted. A json string is a valid yaml double quoted scalar
+func yamlString(value string) string {
+	return strings.TrimSuffix(marshalJSON(value), "\n")
+}
+
+// Encodes the value as indented json, without escaping <, > and &, that are common in ACLs
+func marshalJSON(value interface{}) string {
+	var builder strings.Builder
+	encoder := json.NewEncoder(&builder)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+	return builder.String()
+}
+
+func indentLines(text string, indent string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "")
+}
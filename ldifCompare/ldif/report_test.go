@@ -0,0 +1,97 @@
+package ldif
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	current := `
+dn: cn=config
+olcLogLevel: stats
+
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcAccess: {0}to * by self write
+olcAccess: {1}to * by * read
+
+dn: olcDatabase={2}monitor,cn=config
+olcDatabase: {2}monitor
+`
+	target := `
+dn: cn=config
+olcLogLevel: sync
+
+dn: olcDatabase={1}monitor,cn=config
+olcDatabase: {1}monitor
+
+dn: olcDatabase={2}mdb,cn=config
+olcDatabase: {2}mdb
+olcAccess: {0}to * by * read
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+	changes := Diff(targetEntries, currentEntries)
+
+	report, err := NewReport(changes, currentEntries, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Summary != (ReportSummary{Added: 1, Deleted: 1, Modified: 2, Renamed: 1}) {
+		t.Errorf("Bad summary: %+v", report.Summary)
+	}
+
+	expected := `{
+  "version": 1,
+  "summary": {
+    "added": 1,
+    "deleted": 1,
+    "modified": 2,
+    "renamed": 1
+  },
+  "changes": [
+    {
+      "dn": "olcDatabase={2}monitor,cn=config",
+      "operation": "delete",
+      "attributes": [
+        {
+          "name": "olcDatabase",
+          "added": [],
+          "removed": [
+            "{2}monitor"
+          ]
+        }
+      ]
+    },
+    {
+      "dn": "olcDatabase={1}mdb,cn=config",
+      "operation": "modrdn",
+      "newDN": "olcDatabase={2}mdb,cn=config",
+      "attributes": []
+    },
+`
+	if !strings.HasPrefix(report.JSON(), expected) {
+		t.Errorf("Bad json report:\n%s", report.JSON())
+	}
+	var decoded Report
+	if err := json.Unmarshal([]byte(report.JSON()), &decoded); err != nil || len(decoded.Changes) != len(changes) {
+		t.Errorf("Json report not read back: %v", err)
+	}
+
+	yaml := report.YAML()
+	for _, part := range []string{
+		"version: 1\nsummary:\n  added: 1\n  deleted: 1\n  modified: 2\n  renamed: 1\nchanges:\n",
+		"  - dn: \"cn=config\"\n    operation: modify\n    attributes:\n      - name: \"olcLogLevel\"\n        added:\n          - \"sync\"\n        removed:\n          - \"stats\"\n",
+		"      - name: \"olcAccess\"\n        added: []\n        removed:\n          - \"{0}to * by self write\"\n",
+	} {
+		if !strings.Contains(yaml, part) {
+			t.Errorf("Missing in yaml report:\n%s\n", part)
+		}
+	}
+
+	empty, _ := NewReport(nil, currentEntries, DefaultOptions())
+	if !strings.HasSuffix(empty.YAML(), "changes: []\n") || !strings.Contains(empty.JSON(), `"changes": []`) {
+		t.Errorf("Bad empty report:\n%s", empty.YAML())
+	}
+}
@@ -0,0 +1,268 @@
+package ldif
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Human readable report of the changes, in markdown or html, for change review tickets. The changes
+// are grouped by entry, as a unified diff of the values of each changed attribute, and the entries
+// without changes are collapsed
+
+// Review has the changes of each entry, and the entries not changed
+type Review struct {
+	Summary   ReportSummary
+	Entries   []ReviewEntry
+	Unchanged []string
+}
+
+// ReviewEntry has all the changes of an entry. Operations are the change types applied to it, in
+// order, and NewDN is set if it has been renamed
+type ReviewEntry struct {
+	DN         string
+	NewDN      string
+	Operations []ChangeType
+	Attributes []ReviewAttribute
+}
+
+// ReviewAttribute is a changed attribute of an entry, with all its values, removed (-), added (+) or
+// unchanged (space)
+type ReviewAttribute struct {
+	Name   string
+	Values []ReviewValue
+}
+
+// ReviewValue is a value of an attribute, and how it changes
+type ReviewValue struct {
+	Change byte
+	Value  string
+}
+
+// NewReview builds the review of the changes, to be applied to the current entries. The sensitive
+// values are redacted, although it is shown whether they change
+func NewReview(changes []ChangeRecord, current EntryList, options Options, redaction Redaction) (Review, error) {
+	report, err := NewReport(changes, current, options)
+	if err != nil {
+		return Review{}, err
+	}
+	review := Review{Summary: report.Summary}
+
+	// Changes are grouped by the DN of the entry, which changes with modrdn
+	type group struct {
+		before *Entry
+		after  *Entry
+		entry  ReviewEntry
+	}
+	var groups []*group
+	byKey := make(map[string]*group)
+	changed := make(map[string]bool)
+
+	set := newEntrySet(current)
+	for _, change := range changes {
+		key := dnKey(change.DN)
+		g := byKey[key]
+		if g == nil {
+			g = &group{entry: ReviewEntry{DN: change.DN}}
+			if entry := set.lookup(change.DN); entry != nil {
+				g.before = copyEntry(*entry)
+			}
+			groups = append(groups, g)
+			byKey[key] = g
+		}
+		changed[key] = true
+
+		// The changes were already applied by NewReport
+		set.apply(change, options.Schema)
+		g.entry.Operations = append(g.entry.Operations, change.ChangeType)
+
+		dn := change.DN
+		if change.ChangeType == ChangeModRDN {
+			dn = renamedDN(change)
+			g.entry.NewDN = dn
+			delete(byKey, key)
+			byKey[dnKey(dn)] = g
+		}
+		g.after = nil
+		if entry := set.lookup(dn); entry != nil {
+			g.after = copyEntry(*entry)
+		}
+	}
+
+	for _, g := range groups {
+		g.entry.Attributes = reviewAttributes(g.before, g.after, options.Schema, redaction)
+		review.Entries = append(review.Entries, g.entry)
+	}
+	for _, entry := range current {
+		if !changed[dnKey(entry.DN)] {
+			review.Unchanged = append(review.Unchanged, entry.DN)
+		}
+	}
+	return review, nil
+}
+
+// Returns the changed attributes, with the values removed, added and kept
+func reviewAttributes(before *Entry, after *Entry, schema *Schema, redaction Redaction) []ReviewAttribute {
+	attributes := make([]ReviewAttribute, 0)
+	for _, changed := range diffAttributes(before, after, schema) {
+		var beforeValues []string
+		if before != nil {
+			beforeValues = before.Attributes[entryAttributeName(before, changed.Name, schema)]
+		}
+		if len(beforeValues) > 0 && isOrderedAttribute(beforeValues, nil) {
+			beforeValues = sortedByIndex(beforeValues)
+		}
+
+		attribute := ReviewAttribute{Name: changed.Name}
+		for _, v := range beforeValues {
+			if containsString(changed.Removed, v) {
+				attribute.Values = append(attribute.Values, ReviewValue{Change: '-', Value: v})
+			} else {
+				attribute.Values = append(attribute.Values, ReviewValue{Change: ' ', Value: v})
+			}
+		}
+		for _, v := range changed.Added {
+			attribute.Values = append(attribute.Values, ReviewValue{Change: '+', Value: v})
+		}
+
+		for i, value := range attribute.Values {
+			attribute.Values[i].Value = redaction.Value(changed.Name, value.Value, schema)
+		}
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Title of an entry: its DN, with the new one if renamed, and the operations
+func (e ReviewEntry) title() string {
+	operations := make([]string, len(e.Operations))
+	for i, operation := range e.Operations {
+		operations[i] = string(operation)
+	}
+	if e.NewDN != "" {
+		return fmt.Sprintf("%s → %s (%s)", e.DN, e.NewDN, strings.Join(operations, ", "))
+	}
+	return fmt.Sprintf("%s (%s)", e.DN, strings.Join(operations, ", "))
+}
+
+// Markdown returns the review as a markdown document. The values are shown in diff code blocks, so
+// that changes are highlighted
+func (r Review) Markdown() string {
+	var builder strings.Builder
+	builder.WriteString("# Changes\n\n")
+	builder.WriteString("| Added | Deleted | Modified | Renamed | Unchanged |\n")
+	builder.WriteString("|------:|--------:|---------:|--------:|----------:|\n")
+	fmt.Fprintf(&builder, "| %d | %d | %d | %d | %d |\n", r.Summary.Added, r.Summary.Deleted, r.Summary.Modified,
+		r.Summary.Renamed, len(r.Unchanged))
+
+	for _, entry := range r.Entries {
+		fmt.Fprintf(&builder, "\n## %s\n", markdownEscape(entry.title()))
+		if len(entry.Attributes) == 0 {
+			continue
+		}
+		var lines strings.Builder
+		for _, attribute := range entry.Attributes {
+			for _, value := range attribute.Values {
+				lines.WriteString(string(value.Change) + formatAttrValue(attribute.Name, value.Value) + "\n")
+			}
+		}
+		fence := codeFence(lines.String())
+		builder.WriteString("\n" + fence + "diff\n" + lines.String() + fence + "\n")
+	}
+
+	if len(r.Unchanged) > 0 {
+		fmt.Fprintf(&builder, "\n<details>\n<summary>%d unchanged entries</summary>\n\n", len(r.Unchanged))
+		for _, dn := range r.Unchanged {
+			builder.WriteString("- " + markdownEscape(dn) + "\n")
+		}
+		builder.WriteString("\n</details>\n")
+	}
+	return builder.String()
+}
+
+// Fence of a code block with the text: a run of backticks longer than any in the text, so that the
+// text cannot close it
+func codeFence(text string) string {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c != '`' {
+			run = 0
+			continue
+		}
+		if run++; run > longest {
+			longest = run
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// Escapes the characters with a meaning in markdown text
+func markdownEscape(text string) string {
+	var builder strings.Builder
+	for _, c := range text {
+		if strings.ContainsRune("\\`*_[]<>|", c) {
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(c)
+	}
+	return builder.String()
+}
+
+const reviewStyle = `body { font-family: sans-serif; margin: 2em; }
+table.summary td, table.summary th { padding: 0.2em 1em; text-align: right; }
+pre { background: #f6f8fa; padding: 0.5em; }
+.added { background: #e6ffec; }
+.removed { background: #ffebe9; }
+.added mark, .removed mark { background: none; font-weight: bold; }
+`
+
+// HTML returns the review as an html page. Added and removed values are highlighted
+func (r Review) HTML() string {
+	var builder strings.Builder
+	builder.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Changes</title>\n")
+	builder.WriteString("<style>\n" + reviewStyle + "</style>\n</head>\n<body>\n<h1>Changes</h1>\n")
+	builder.WriteString("<table class=\"summary\">\n<tr><th>Added</th><th>Deleted</th><th>Modified</th><th>Renamed</th><th>Unchanged</th></tr>\n")
+	fmt.Fprintf(&builder, "<tr><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td></tr>\n</table>\n",
+		r.Summary.Added, r.Summary.Deleted, r.Summary.Modified, r.Summary.Renamed, len(r.Unchanged))
+
+	classes := map[byte]string{'+': "added", '-': "removed", ' ': "unchanged"}
+	for _, entry := range r.Entries {
+		fmt.Fprintf(&builder, "<h2>%s</h2>\n", html.EscapeString(entry.title()))
+		if len(entry.Attributes) == 0 {
+			continue
+		}
+		builder.WriteString("<pre>")
+		for _, attribute := range entry.Attributes {
+			for _, value := range attribute.Values {
+				line := html.EscapeString(formatAttrValue(attribute.Name, value.Value))
+				if value.Change != ' ' {
+					line = "<mark>" + line + "</mark>"
+				}
+				fmt.Fprintf(&builder, "<span class=\"%s\">%c%s</span>\n", classes[value.Change], value.Change, line)
+			}
+		}
+		builder.WriteString("</pre>\n")
+	}
+
+	if len(r.Unchanged) > 0 {
+		fmt.Fprintf(&builder, "<details>\n<summary>%d unchanged entries</summary>\n<ul>\n", len(r.Unchanged))
+		for _, dn := range r.Unchanged {
+			builder.WriteString("<li>" + html.EscapeString(dn) + "</li>\n")
+		}
+		builder.WriteString("</ul>\n</details>\n")
+	}
+	builder.WriteString("</body>\n</html>\n")
+	return builder.String()
+}
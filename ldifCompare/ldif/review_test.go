@@ -0,0 +1,92 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReview(t *testing.T) {
+	current := `
+dn: cn=config
+olcLogLevel: stats
+
+dn: olcDatabase={0}config,cn=config
+olcDatabase: {0}config
+olcRootPW: secret
+
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcSuffix: dc=example,dc=com
+olcAccess: {0}to * by self write
+olcAccess: {1}to * by * read
+
+dn: olcDatabase={2}monitor,cn=config
+olcDatabase: {2}monitor
+`
+	target := `
+dn: cn=config
+olcLogLevel: stats
+
+dn: olcDatabase={0}config,cn=config
+olcDatabase: {0}config
+olcRootPW: other secret
+
+dn: olcDatabase={1}mdb,cn=config
+olcDatabase: {1}mdb
+olcSuffix: dc=example,dc=com
+olcAccess: {0}to * by * read
+olcDbIndex: uid eq
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+	changes := Diff(targetEntries, currentEntries)
+
+	review, err := NewReview(changes, currentEntries, DefaultOptions(), DefaultRedaction())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(review.Entries) != 3 || len(review.Unchanged) != 1 || review.Unchanged[0] != "cn=config" {
+		t.Fatalf("Bad review: %+v", review)
+	}
+
+	markdown := review.Markdown()
+	for _, part := range []string{
+		"| 0 | 1 | 2 | 0 | 1 |\n",
+		"## olcDatabase={0}config,cn=config (modify)\n\n```diff\n-olcRootPW: ********\n+olcRootPW: ********\n```\n",
+		"## olcDatabase={1}mdb,cn=config (modify)\n\n```diff\n-olcAccess: {0}to * by self write\n olcAccess: {1}to * by * read\n+olcDbIndex: uid eq\n```\n",
+		"<summary>1 unchanged entries</summary>\n\n- cn=config\n",
+	} {
+		if !strings.Contains(markdown, part) {
+			t.Errorf("Missing in markdown review:\n%s\nin\n%s", part, markdown)
+		}
+	}
+
+	html := review.HTML()
+	for _, part := range []string{
+		"<h2>olcDatabase={2}monitor,cn=config (delete)</h2>\n<pre><span class=\"removed\">-<mark>olcDatabase: {2}monitor</mark></span>\n</pre>\n",
+		"<span class=\"unchanged\"> olcAccess: {1}to * by * read</span>\n",
+		"<li>cn=config</li>\n",
+	} {
+		if !strings.Contains(html, part) {
+			t.Errorf("Missing in html review:\n%s\nin\n%s", part, html)
+		}
+	}
+	if strings.Contains(markdown+html, "secret") {
+		t.Errorf("Masked value shown")
+	}
+}
+
+func TestReviewMarkdownFence(t *testing.T) {
+	current, _ := Parse(strings.NewReader("dn: cn=config\ndescription: plain\n"))
+	target, _ := Parse(strings.NewReader("dn: cn=config\ndescription: with ```code``` and ````more````\n"))
+
+	review, err := NewReview(Diff(target, current), current, DefaultOptions(), DefaultRedaction())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The values cannot close the code block
+	expected := "\n`````diff\n-description: plain\n+description: with ```code``` and ````more````\n`````\n"
+	if markdown := review.Markdown(); !strings.Contains(markdown, expected) {
+		t.Errorf("Bad code block in markdown review:\n%s", markdown)
+	}
+}
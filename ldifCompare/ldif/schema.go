@@ -0,0 +1,265 @@
+package ldif
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schema aware comparison of values. Each attribute type has an equality matching rule, which
+// is used to normalize the values before comparing them
+
+// AttributeType is the definition of an attribute type, as found in the schema (RFC 4512)
+type AttributeType struct {
+	OID         string
+	Names       []string
+	Sup         string
+	Equality    string
+	SingleValue bool
+}
+
+// Schema holds the attribute type definitions, indexed by lowercase name and OID
+type Schema struct {
+	attributeTypes map[string]*AttributeType
+}
+
+// NewSchema returns an empty schema, where values are compared byte by byte
+func NewSchema() *Schema {
+	return &Schema{attributeTypes: make(map[string]*AttributeType)}
+}
+
+// DefaultSchema returns a schema with the built-in definitions of the cn=config attributes and
+// of the most common attributes of the core schema
+func DefaultSchema() *Schema {
+	schema := NewSchema()
+	for rule, names := range builtinEqualities {
+		for _, name := range names {
+			schema.Add(&AttributeType{Names: []string{name}, Equality: rule, SingleValue: IsSingleValued(name)})
+		}
+	}
+	// Aliases
+	schema.Add(&AttributeType{OID: "2.5.4.3", Names: []string{"cn", "commonName"}, Equality: "caseIgnoreMatch"})
+	schema.Add(&AttributeType{OID: "0.9.2342.19200300.100.1.25", Names: []string{"dc", "domainComponent"}, Equality: "caseIgnoreIA5Match"})
+	schema.Add(&AttributeType{OID: "2.5.4.11", Names: []string{"ou", "organizationalUnitName"}, Equality: "caseIgnoreMatch"})
+	schema.Add(&AttributeType{OID: "2.5.4.10", Names: []string{"o", "organizationName"}, Equality: "caseIgnoreMatch"})
+	schema.Add(&AttributeType{OID: "2.5.4.4", Names: []string{"sn", "surname"}, Equality: "caseIgnoreMatch"})
+	schema.Add(&AttributeType{OID: "0.9.2342.19200300.100.1.1", Names: []string{"uid", "userid"}, Equality: "caseIgnoreMatch"})
+	return schema
+}
+
+// Attributes of cn=config and the core schema, by equality matching rule
+var builtinEqualities = map[string][]string{
+	"booleanMatch": {
+		"olcGentleHUP", "olcIndexHash64", "olcReadOnly", "olcSaslAuxpropsDontUseCopyIgnore", "olcAddContentAcl",
+		"olcLastMod", "olcLastBind", "olcSyncUseSubentry", "olcMonitoring", "olcDbNoSync", "olcHidden", "olcMirrorMode",
+		"olcMultiProvider", "olcReverseLookup", "olcPPolicyHashCleartext", "olcPPolicyUseLockout", "olcSpNoPresent",
+		"olcSpReloadHint",
+	},
+	"integerMatch": {
+		"olcConcurrency", "olcConnMaxPending", "olcConnMaxPendingAuth", "olcIdleTimeout", "olcIndexSubstrIfMaxLen",
+		"olcIndexSubstrIfMinLen", "olcIndexSubstrAnyLen", "olcIndexSubstrAnyStep", "olcIndexIntLen", "olcListenerThreads",
+		"olcLocalSSF", "olcMaxFilterDepth", "olcSockbufMaxIncoming", "olcSockbufMaxIncomingAuth", "olcThreads",
+		"olcThreadQueues", "olcToolThreads", "olcWriteTimeout", "olcMaxDerefDepth", "olcDbMaxReaders", "olcDbMaxSize",
+		"olcDbSearchStack", "olcDbMaxEntrySize", "olcDbRtxnSize", "uidNumber", "gidNumber",
+	},
+	"distinguishedNameMatch": {
+		"olcRootDN", "olcSuffix", "olcUpdateDN", "olcSchemaDN", "olcPPolicyDefault", "olcAccessLogDB", "member",
+		"uniqueMember", "manager", "seeAlso", "creatorsName", "modifiersName",
+	},
+	"objectIdentifierMatch": {
+		"objectClass", "structuralObjectClass",
+	},
+	"caseIgnoreMatch": {
+		"olcDatabase", "olcOverlay", "olcBackend", "olcLogLevel", "olcTLSCRLCheck", "olcTLSVerifyClient",
+		"olcAuthzPolicy", "olcSaslSecProps", "olcDbIndex", "olcRequires", "olcAllows", "olcDisallows", "olcSecurity",
+		"description", "givenName", "displayName", "title", "l", "st", "street",
+	},
+	"caseIgnoreIA5Match": {
+		"mail",
+	},
+	// Credentials, and rules with regular expressions and quoted values, where the case matters
+	"octetStringMatch": {
+		"olcRootPW", "userPassword", "olcAccess", "olcSyncrepl", "olcLimits",
+	},
+}
+
+// Add adds an attribute type definition, replacing any previous one with the same names or OID
+func (s *Schema) Add(attributeType *AttributeType) {
+	if attributeType.OID != "" {
+		s.attributeTypes[attributeType.OID] = attributeType
+	}
+	for _, name := range attributeType.Names {
+		s.attributeTypes[strings.ToLower(name)] = attributeType
+	}
+}
+
+// Lookup returns the definition of an attribute type, by name or OID. Options (;lang-es) are ignored
+func (s *Schema) Lookup(name string) (*AttributeType, bool) {
+	if s == nil {
+		return nil, false
+	}
+	base := strings.ToLower(name)
+	if semicolon := strings.IndexByte(base, ';'); semicolon >= 0 {
+		base = base[:semicolon]
+	}
+	attributeType, found := s.attributeTypes[base]
+	return attributeType, found
+}
+
+// Returns the equality matching rule of the attribute type, looking in the supertypes if not defined
+func (s *Schema) equality(name string) string {
+	for i := 0; i < 10; i++ {
+		attributeType, found := s.Lookup(name)
+		if !found {
+			return ""
+		}
+		if attributeType.Equality != "" || attributeType.Sup == "" {
+			return attributeType.Equality
+		}
+		name = attributeType.Sup
+	}
+	return ""
+}
+
+// AttributeKey returns the key used to compare attribute names: the first name of the attribute
+// type, or the name itself if unknown, in lowercase and with the options
+func (s *Schema) AttributeKey(name string) string {
+	key := strings.ToLower(name)
+	options := ""
+	if semicolon := strings.IndexByte(key, ';'); semicolon >= 0 {
+		key, options = key[:semicolon], key[semicolon:]
+	}
+	if attributeType, found := s.Lookup(key); found && len(attributeType.Names) > 0 {
+		key = strings.ToLower(attributeType.Names[0])
+	}
+	return key + options
+}
+
+// NormalizeValue returns the value in the form used to compare it, according to the equality
+// matching rule of the attribute. Values of unknown attributes are compared byte by byte
+func (s *Schema) NormalizeValue(name string, value string) string {
+	switch s.equality(name) {
+	case "caseIgnoreMatch", "caseIgnoreIA5Match", "caseIgnoreListMatch", "objectIdentifierMatch":
+		return strings.ToLower(strings.Join(strings.Fields(value), " "))
+	case "caseExactMatch", "caseExactIA5Match":
+		return strings.Join(strings.Fields(value), " ")
+	case "booleanMatch":
+		return strings.ToUpper(strings.TrimSpace(value))
+	case "integerMatch":
+		if i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		return strings.TrimSpace(value)
+	case "numericStringMatch":
+		return strings.Join(strings.Fields(value), "")
+	case "telephoneNumberMatch":
+		return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(value))
+	case "distinguishedNameMatch":
+		return NormalizeDN(value)
+	default:
+		return value
+	}
+}
+
+// LoadSchema reads the attribute type definitions from the entries of a schema dump, either
+// from the olcAttributeTypes values of cn=schema,cn=config or from the attributeTypes values
+// of a subschema subentry
+func (s *Schema) LoadSchema(entries EntryList) error {
+	for _, entry := range entries {
+		for name, values := range entry.Attributes {
+			if !strings.EqualFold(name, "olcAttributeTypes") && !strings.EqualFold(name, "attributeTypes") {
+				continue
+			}
+			for _, value := range values {
+				_, definition, _ := splitOrderedValue(value)
+				attributeType, err := ParseAttributeType(definition)
+				if err != nil {
+					return fmt.Errorf("%s: %w", entry.DN, err)
+				}
+				s.Add(attributeType)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseAttributeType parses an attribute type description, as in
+// ( 2.5.4.3 NAME ( 'cn' 'commonName' ) SUP name EQUALITY caseIgnoreMatch )
+func ParseAttributeType(definition string) (*AttributeType, error) {
+	tokens := tokenizeSchemaDefinition(definition)
+	if len(tokens) < 3 || tokens[0] != "(" || tokens[len(tokens)-1] != ")" {
+		return nil, fmt.Errorf("invalid attribute type definition %q", definition)
+	}
+
+	attributeType := &AttributeType{OID: tokens[1]}
+	for i := 2; i < len(tokens)-1; i++ {
+		switch strings.ToUpper(tokens[i]) {
+		case "NAME":
+			var names []string
+			names, i = schemaTokenList(tokens, i+1)
+			attributeType.Names = names
+		case "SUP":
+			if i+1 < len(tokens) {
+				i++
+				attributeType.Sup = tokens[i]
+			}
+		case "EQUALITY":
+			if i+1 < len(tokens) {
+				i++
+				attributeType.Equality = tokens[i]
+			}
+		case "SINGLE-VALUE":
+			attributeType.SingleValue = true
+		}
+	}
+	return attributeType, nil
+}
+
+// Returns a single token, or the list of tokens between parentheses, starting at position i,
+// and the position of the last token consumed. Quotes are removed
+func schemaTokenList(tokens []string, i int) ([]string, int) {
+	if i >= len(tokens) {
+		return nil, i
+	}
+	if tokens[i] != "(" {
+		return []string{strings.Trim(tokens[i], "'")}, i
+	}
+	var list []string
+	for i++; i < len(tokens) && tokens[i] != ")"; i++ {
+		if tokens[i] != "$" {
+			list = append(list, strings.Trim(tokens[i], "'"))
+		}
+	}
+	return list, i
+}
+
+// Splits a schema definition in parentheses, quoted strings and words
+func tokenizeSchemaDefinition(definition string) []string {
+	var tokens []string
+	for i := 0; i < len(definition); {
+		c := definition[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			end := strings.IndexByte(definition[i+1:], '\'')
+			if end < 0 {
+				tokens = append(tokens, definition[i:])
+				return tokens
+			}
+			tokens = append(tokens, definition[i:i+end+2])
+			i += end + 2
+		default:
+			end := i
+			for end < len(definition) && strings.IndexByte(" \t\n()'", definition[end]) < 0 {
+				end++
+			}
+			tokens = append(tokens, definition[i:end])
+			i = end
+		}
+	}
+	return tokens
+}
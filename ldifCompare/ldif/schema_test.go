@@ -0,0 +1,77 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffWithSchema(t *testing.T) {
+	current := `
+dn: olcDatabase={1}mdb,cn=config
+objectclass: olcMdbConfig
+olcReadOnly: false
+olcRootDN: cn=Manager, dc=example,dc=com
+olcDbMaxSize: 01073741824
+description: Main  Database
+customAttr: Value
+`
+	target := `
+dn: olcDatabase={1}mdb,cn=config
+objectClass: OLCMdbConfig
+OLCREADONLY: FALSE
+olcRootDN: CN=manager,dc=example,dc=com
+olcDbMaxSize: 1073741824
+description: main database
+customAttr: value
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	// Only the attribute not in the schema is different
+	changes := FormatChanges(Diff(targetEntries, currentEntries))
+	expected := "dn: olcDatabase={1}mdb,cn=config\nchangetype: modify\ndelete: customAttr\ncustomAttr: Value\n-\nadd: customAttr\ncustomAttr: value\n\n"
+	if changes != expected {
+		t.Fatalf("Bad changes using default schema:\n%s", changes)
+	}
+
+	// Load the definition of the attribute, with a case insensitive matching rule
+	schemaEntries, _ := Parse(strings.NewReader(`
+dn: cn={0}custom,cn=schema,cn=config
+olcAttributeTypes: {0}( 1.3.6.1.4.1.99999.1 NAME ( 'customAttr' 'custom' ) DESC 'Custom' EQUALITY caseIgnoreMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 SINGLE-VALUE )
+`))
+	options := DefaultOptions()
+	if err := options.Schema.LoadSchema(schemaEntries); err != nil {
+		t.Fatal(err)
+	}
+	if changes := DiffWithOptions(targetEntries, currentEntries, options); len(changes) != 0 {
+		t.Fatalf("Expected no changes but got:\n%s", FormatChanges(changes))
+	}
+
+	attributeType, found := options.Schema.Lookup("CUSTOM")
+	if !found || attributeType.OID != "1.3.6.1.4.1.99999.1" || !attributeType.SingleValue {
+		t.Fatalf("Bad attribute type definition %v", attributeType)
+	}
+}
+
+func TestDiffCaseSensitiveConfig(t *testing.T) {
+	current := `
+dn: olcDatabase={1}mdb,cn=config
+olcSyncrepl: {0}rid=001 provider=ldap://ldap-0 binddn="cn=repl" credentials="Secret"
+olcAccess: {0}to * by dn.regex="^uid=Admin,.*$" write
+`
+	target := `
+dn: olcDatabase={1}mdb,cn=config
+olcSyncrepl: {0}rid=001 provider=ldap://ldap-0 binddn="cn=repl" credentials="secret"
+olcAccess: {0}to * by dn.regex="^uid=admin,.*$" write
+`
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	// A password or a regular expression that only changes in case is a change
+	changes := FormatChanges(DiffWithOptions(targetEntries, currentEntries, DefaultOptions()))
+	for _, part := range []string{"changetype: modify\n", `credentials="secret"`, `dn.regex="^uid=admin,.*$"`} {
+		if !strings.Contains(changes, part) {
+			t.Fatalf("Missing %q in changes:\n%s", part, changes)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package ldif
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selection of the entries that take part in the comparison, by position in the tree, as in an
+// ldapsearch base and scope, and by an LDAP filter (RFC 4515)
+
+// Scope is the part of the tree under the base DN that is selected
+type Scope int
+
+// Scopes, as in ldapsearch -s
+const (
+	// The base entry and all its descendants
+	ScopeSub Scope = iota
+	// The children of the base entry
+	ScopeOne
+	// Only the base entry
+	ScopeBase
+)
+
+var scopeNames = map[string]Scope{
+	"sub":  ScopeSub,
+	"one":  ScopeOne,
+	"base": ScopeBase,
+}
+
+// ParseScope converts the name of a scope (base, one or sub) to its value
+func ParseScope(name string) (Scope, error) {
+	if scope, found := scopeNames[strings.ToLower(name)]; found {
+		return scope, nil
+	}
+	return ScopeSub, fmt.Errorf("unknown scope %q", name)
+}
+
+// Selection restricts the entries to compare. Base and Scope select a part of the tree (an empty
+// Base is the root of the tree), entries in or under any of the Exclude DNs are left out, and, if
+// Filter is not nil, only the entries that match it are selected
+type Selection struct {
+	Base    string
+	Scope   Scope
+	Exclude []string
+	Filter  Filter
+}
+
+// Apply returns the selected entries of both sides. An entry is selected in both sides if it
+// matches the filter in any of them, so that a change in the attributes used in the filter is
+// seen as a modify, and not as an add or a delete
+func (s Selection) Apply(targetLdif EntryList, currentLdif EntryList, schema *Schema) (EntryList, EntryList, error) {
+	base, err := ParseDN(s.Base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid base %q: %w", s.Base, err)
+	}
+	excluded := make([]DN, len(s.Exclude))
+	for i, dn := range s.Exclude {
+		if excluded[i], err = ParseDN(dn); err != nil {
+			return nil, nil, fmt.Errorf("invalid excluded subtree %q: %w", dn, err)
+		}
+	}
+
+	inScope := func(entry Entry) bool {
+		dn, err := ParseDN(entry.DN)
+		if err != nil {
+			// Invalid DNs are only selected when the whole tree is
+			return len(base) == 0 && s.Scope == ScopeSub && len(excluded) == 0
+		}
+		if !isUnder(dn, base) {
+			return false
+		}
+		switch {
+		case s.Scope == ScopeBase && len(dn) != len(base):
+			return false
+		case s.Scope == ScopeOne && len(dn) != len(base)+1:
+			return false
+		}
+		for _, exclude := range excluded {
+			if isUnder(dn, exclude) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// DNs of the entries that match the filter in any side
+	matching := make(map[string]bool)
+	if s.Filter != nil {
+		for _, entries := range []EntryList{targetLdif, currentLdif} {
+			for _, entry := range entries {
+				if s.Filter.Matches(entry, schema) {
+					matching[dnKey(entry.DN)] = true
+				}
+			}
+		}
+	}
+
+	selected := func(entries EntryList) EntryList {
+		result := make(EntryList, 0, len(entries))
+		for _, entry := range entries {
+			if inScope(entry) && (s.Filter == nil || matching[dnKey(entry.DN)]) {
+				result = append(result, entry)
+			}
+		}
+		return result
+	}
+
+	return selected(targetLdif), selected(currentLdif), nil
+}
+
+// Whether dn is base or one of its descendants
+func isUnder(dn DN, base DN) bool {
+	return len(dn) >= len(base) && dn[len(dn)-len(base):].Normalized() == base.Normalized()
+}
+
+// Filter is an LDAP search filter, evaluated on the entries of an ldif
+type Filter interface {
+	// Matches returns whether the entry matches the filter. Values are compared using the
+	// matching rules in the schema
+	Matches(entry Entry, schema *Schema) bool
+}
+
+// ParseFilter parses a filter in the string format of RFC 4515, such as
+// (&(objectClass=olcDatabaseConfig)(!(olcDatabase=*monitor))). Equality, presence, substrings,
+// >=, <= and ~= (as equality) are supported, but not extensible matches. The outer parentheses are optional
+func ParseFilter(text string) (Filter, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "(") {
+		text = "(" + text + ")"
+	}
+	filter, rest, err := parseFilter(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", text, err)
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q", text, rest)
+	}
+	return filter, nil
+}
+
+// Parses a filter between parentheses at the start of the text. Returns the filter and the rest of the text
+func parseFilter(text string) (Filter, string, error) {
+	text = strings.TrimLeft(text, " ")
+	if !strings.HasPrefix(text, "(") {
+		return nil, text, fmt.Errorf("expected ( at %q", text)
+	}
+	text = strings.TrimLeft(text[1:], " ")
+	if text == "" {
+		return nil, text, fmt.Errorf("unexpected end of filter")
+	}
+
+	switch text[0] {
+	case '&', '|':
+		operator := text[0]
+		var filters []Filter
+		text = strings.TrimLeft(text[1:], " ")
+		for strings.HasPrefix(text, "(") {
+			var filter Filter
+			var err error
+			if filter, text, err = parseFilter(text); err != nil {
+				return nil, text, err
+			}
+			filters = append(filters, filter)
+			text = strings.TrimLeft(text, " ")
+		}
+		if !strings.HasPrefix(text, ")") {
+			return nil, text, fmt.Errorf("expected ) at %q", text)
+		}
+		if operator == '&' {
+			return andFilter(filters), text[1:], nil
+		}
+		return orFilter(filters), text[1:], nil
+
+	case '!':
+		filter, rest, err := parseFilter(text[1:])
+		if err != nil {
+			return nil, rest, err
+		}
+		rest = strings.TrimLeft(rest, " ")
+		if !strings.HasPrefix(rest, ")") {
+			return nil, rest, fmt.Errorf("expected ) at %q", rest)
+		}
+		return notFilter{filter}, rest[1:], nil
+
+	default:
+		end := strings.IndexByte(text, ')')
+		if end < 0 {
+			return nil, text, fmt.Errorf("expected ) at %q", text)
+		}
+		filter, err := parseItem(text[:end])
+		return filter, text[end+1:], err
+	}
+}
+
+// Parses a simple filter item, such as olcDatabase=*mdb, without parentheses
+func parseItem(item string) (Filter, error) {
+	equal := strings.IndexByte(item, '=')
+	if equal < 1 {
+		return nil, fmt.Errorf("invalid item %q", item)
+	}
+	attribute, operator, value := item[:equal], "=", item[equal+1:]
+	switch attribute[len(attribute)-1] {
+	case '>', '<', '~':
+		attribute, operator = attribute[:len(attribute)-1], attribute[len(attribute)-1:]+"="
+	case ':':
+		return nil, fmt.Errorf("extensible match not supported in %q", item)
+	}
+	attribute = strings.TrimSpace(attribute)
+	if attribute == "" {
+		return nil, fmt.Errorf("invalid item %q", item)
+	}
+
+	if operator == "=" && value == "*" {
+		return presentFilter{attribute}, nil
+	}
+
+	// Substrings are split before unescaping, as an escaped \2a is not a wildcard
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		unescaped, err := unescapeFilterValue(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid item %q: %w", item, err)
+		}
+		parts[i] = unescaped
+	}
+	if len(parts) > 1 {
+		if operator != "=" {
+			return nil, fmt.Errorf("invalid item %q", item)
+		}
+		return substringFilter{attribute: attribute, parts: parts}, nil
+	}
+	return compareFilter{attribute: attribute, operator: operator, value: parts[0]}, nil
+}
+
+// Replaces the \XX escapes in a filter value by the bytes they represent
+func unescapeFilterValue(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			builder.WriteByte(value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", fmt.Errorf("incomplete escape in %q", value)
+		}
+		b, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", value)
+		}
+		builder.WriteByte(byte(b))
+		i += 2
+	}
+	return builder.String(), nil
+}
+
+type andFilter []Filter
+
+func (f andFilter) Matches(entry Entry, schema *Schema) bool {
+	for _, filter := range f {
+		if !filter.Matches(entry, schema) {
+			return false
+		}
+	}
+	return true
+}
+
+type orFilter []Filter
+
+func (f orFilter) Matches(entry Entry, schema *Schema) bool {
+	for _, filter := range f {
+		if filter.Matches(entry, schema) {
+			return true
+		}
+	}
+	return false
+}
+
+type notFilter struct {
+	filter Filter
+}
+
+func (f notFilter) Matches(entry Entry, schema *Schema) bool {
+	return !f.filter.Matches(entry, schema)
+}
+
+type presentFilter struct {
+	attribute string
+}
+
+func (f presentFilter) Matches(entry Entry, schema *Schema) bool {
+	return len(entry.Attributes[entryAttributeName(&entry, f.attribute, schema)]) > 0
+}
+
+type compareFilter struct {
+	attribute string
+	operator  string
+	value     string
+}
+
+func (f compareFilter) Matches(entry Entry, schema *Schema) bool {
+	name := entryAttributeName(&entry, f.attribute, schema)
+	expected := schema.NormalizeValue(name, f.value)
+	for _, v := range entry.Attributes[name] {
+		normalized := schema.NormalizeValue(name, v)
+		switch f.operator {
+		case "=", "~=":
+			if normalized == expected {
+				return true
+			}
+		case ">=":
+			if compareFilterValues(normalized, expected) >= 0 {
+				return true
+			}
+		case "<=":
+			if compareFilterValues(normalized, expected) <= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Compares two values as integers if both are, or as strings otherwise
+func compareFilterValues(a string, b string) int {
+	if i, err := strconv.ParseInt(a, 10, 64); err == nil {
+		if j, err := strconv.ParseInt(b, 10, 64); err == nil {
+			switch {
+			case i < j:
+				return -1
+			case i > j:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// A substrings filter, such as cn=ab*cd*ef, as the list of parts between the *
+type substringFilter struct {
+	attribute string
+	parts     []string
+}
+
+func (f substringFilter) Matches(entry Entry, schema *Schema) bool {
+	name := entryAttributeName(&entry, f.attribute, schema)
+	for _, v := range entry.Attributes[name] {
+		if matchSubstrings(foldSubstring(name, v, schema), f.parts, func(part string) string { return foldSubstring(name, part, schema) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// Values are compared ignoring case in substrings filters if the equality matching rule does.
+// Spaces are kept, as they may be significant at the start or end of a part
+func foldSubstring(name string, value string, schema *Schema) string {
+	if schema.NormalizeValue(name, "A") == "a" {
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+func matchSubstrings(value string, parts []string, fold func(string) string) bool {
+	initial := fold(parts[0])
+	if !strings.HasPrefix(value, initial) {
+		return false
+	}
+	value = value[len(initial):]
+	final := fold(parts[len(parts)-1])
+	for _, part := range parts[1 : len(parts)-1] {
+		part = fold(part)
+		position := strings.Index(value, part)
+		if position < 0 {
+			return false
+		}
+		value = value[position+len(part):]
+	}
+	return len(value) >= len(final) && strings.HasSuffix(value, final)
+}
@@ -0,0 +1,103 @@
+package ldif
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelection(t *testing.T) {
+	content := `
+dn: cn=config
+objectClass: olcGlobal
+cn: config
+
+dn: cn=schema,cn=config
+objectClass: olcSchemaConfig
+cn: schema
+
+dn: cn={0}core,cn=schema,cn=config
+objectClass: olcSchemaConfig
+cn: {0}core
+
+dn: olcDatabase={1}mdb,cn=config
+objectClass: olcDatabaseConfig
+objectClass: olcMdbConfig
+olcDatabase: {1}mdb
+olcDbMaxSize: 1073741824
+
+dn: olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config
+objectClass: olcOverlayConfig
+objectClass: olcSyncProvConfig
+olcOverlay: {0}syncprov
+
+dn: olcDatabase={2}monitor,cn=config
+objectClass: olcDatabaseConfig
+olcDatabase: {2}monitor
+`
+	entries, _ := Parse(strings.NewReader(content))
+
+	cases := []struct {
+		base     string
+		scope    string
+		exclude  []string
+		filter   string
+		expected []string
+	}{
+		{"", "sub", nil, "", []string{"cn=config", "cn=schema,cn=config", "cn={0}core,cn=schema,cn=config", "olcDatabase={1}mdb,cn=config", "olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config", "olcDatabase={2}monitor,cn=config"}},
+		{"olcDatabase={1}MDB,cn=config", "sub", nil, "", []string{"olcDatabase={1}mdb,cn=config", "olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config"}},
+		{"cn=config", "one", nil, "", []string{"cn=schema,cn=config", "olcDatabase={1}mdb,cn=config", "olcDatabase={2}monitor,cn=config"}},
+		{"cn=config", "base", nil, "", []string{"cn=config"}},
+		{"", "sub", []string{"cn=schema,cn=config", "olcDatabase={2}monitor,cn=config"}, "", []string{"cn=config", "olcDatabase={1}mdb,cn=config", "olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config"}},
+		{"", "sub", nil, "(!(objectClass=olcSchemaConfig))", []string{"cn=config", "olcDatabase={1}mdb,cn=config", "olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config", "olcDatabase={2}monitor,cn=config"}},
+		{"", "sub", nil, "(&(objectClass=OLCDATABASECONFIG)(|(olcDatabase=*monitor)(olcDbMaxSize>=1000)))", []string{"olcDatabase={1}mdb,cn=config", "olcDatabase={2}monitor,cn=config"}},
+		{"", "sub", nil, "olcOverlay=*", []string{"olcOverlay={0}syncprov,olcDatabase={1}mdb,cn=config"}},
+		{"", "sub", nil, "(cn=\\7b0\\7d*)", []string{"cn={0}core,cn=schema,cn=config"}},
+		{"", "sub", nil, "(olcDatabase={1}m*b)", []string{"olcDatabase={1}mdb,cn=config"}},
+	}
+
+	for _, c := range cases {
+		scope, err := ParseScope(c.scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selection := Selection{Base: c.base, Scope: scope, Exclude: c.exclude}
+		if c.filter != "" {
+			if selection.Filter, err = ParseFilter(c.filter); err != nil {
+				t.Fatal(err)
+			}
+		}
+		selected, _, err := selection.Apply(entries, nil, DefaultSchema())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dns []string
+		for _, entry := range selected {
+			dns = append(dns, entry.DN)
+		}
+		if strings.Join(dns, "\n") != strings.Join(c.expected, "\n") {
+			t.Errorf("Bad selection for %+v:\n%s", c, strings.Join(dns, "\n"))
+		}
+	}
+
+	for _, invalid := range []string{"(cn=a", "(&(cn=a)", "cn", "(cn:dn:=a)", "(cn=\\4)", "(cn>=a*)", "(cn=a))"} {
+		if _, err := ParseFilter(invalid); err == nil {
+			t.Errorf("Expected error parsing filter %q", invalid)
+		}
+	}
+}
+
+func TestSelectionFilterBothSides(t *testing.T) {
+	current := "dn: cn=a\nobjectClass: person\ncn: a\n\ndn: cn=b\nobjectClass: person\ncn: b\n"
+	target := "dn: cn=a\nobjectClass: account\ncn: a\n"
+	currentEntries, _ := Parse(strings.NewReader(current))
+	targetEntries, _ := Parse(strings.NewReader(target))
+
+	// cn=a no longer matches in the target, but it is compared, and not deleted
+	filter, _ := ParseFilter("(objectClass=person)")
+	targetSelected, currentSelected, _ := Selection{Filter: filter}.Apply(targetEntries, currentEntries, DefaultSchema())
+	changes := FormatChanges(Diff(targetSelected, currentSelected))
+	expected := "dn: cn=b\nchangetype: delete\n\ndn: cn=a\nchangetype: modify\ndelete: objectClass\nobjectClass: person\n-\nadd: objectClass\nobjectClass: account\n\n"
+	if changes != expected {
+		t.Errorf("Bad changes:\n%s", changes)
+	}
+}
@@ -0,0 +1,447 @@
+package ldif
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Comparison of big ldifs, such as slapcat exports of databases, without loading them in memory.
+// The entries are read one by one, sorted externally using temporary files, and merge-joined
+
+// ErrNotSorted is returned when the entries of a stream are not sorted, or a DN is repeated
+var ErrNotSorted = errors.New("entries not sorted, or repeated")
+
+// EntryIterator is a sequence of entries. Next returns io.EOF after the last one
+type EntryIterator interface {
+	Next() (Entry, error)
+}
+
+// Reader reads the entries of an ldif one by one, in the order they are in the input
+type Reader struct {
+	records *recordReader
+}
+
+// NewReader returns a Reader of the ldif
+func NewReader(r io.Reader) *Reader {
+	return &Reader{records: newRecordReader(r)}
+}
+
+// Next returns the next entry, or io.EOF
+func (r *Reader) Next() (Entry, error) {
+	record, err := r.records.next()
+	if err != nil {
+		return Entry{}, err
+	}
+	return parseRecord(record)
+}
+
+// StreamOptions limits the memory used to sort the entries. At most ChunkSize entries are sorted in
+// memory, and written to a temporary file in TempDir, the default one if empty
+type StreamOptions struct {
+	ChunkSize int
+	TempDir   string
+}
+
+// DefaultStreamOptions returns chunks of 100000 entries in the default temporary directory
+func DefaultStreamOptions() StreamOptions {
+	return StreamOptions{ChunkSize: 100000}
+}
+
+// An entry with its sort key, so that DNs are parsed only once
+type keyedEntry struct {
+	Entry
+	key []string
+}
+
+func newKeyedEntry(entry Entry) keyedEntry {
+	return keyedEntry{Entry: entry, key: dnSortKey(entry.DN)}
+}
+
+// SortedEntries returns the entries of an iterator sorted, parents first (see CompareDN). It must be
+// closed to remove the temporary files
+type SortedEntries struct {
+	chunks  []*os.File
+	merging mergeHeap
+}
+
+// SortEntries reads all the entries from the iterator and sorts them. If there are more than
+// options.ChunkSize entries, they are sorted in chunks, written to temporary files, and merged
+func SortEntries(entries EntryIterator, options StreamOptions) (*SortedEntries, error) {
+	return sortEntries(entries, options, false)
+}
+
+// Sorts the entries, in reverse order if specified, so that children are before their parents
+func sortEntries(entries EntryIterator, options StreamOptions, reverse bool) (*SortedEntries, error) {
+	sorted := &SortedEntries{merging: mergeHeap{reverse: reverse}}
+	chunkSize := options.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultStreamOptions().ChunkSize
+	}
+
+	sortChunk := func(chunk []keyedEntry) {
+		sort.SliceStable(chunk, func(i, j int) bool {
+			return (compareDNKeys(chunk[i].key, chunk[j].key) < 0) != reverse
+		})
+	}
+
+	var chunk []keyedEntry
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sorted.Close()
+			return nil, err
+		}
+		chunk = append(chunk, newKeyedEntry(entry))
+		if len(chunk) < chunkSize {
+			continue
+		}
+		sortChunk(chunk)
+		if err := sorted.writeChunk(chunk, options.TempDir); err != nil {
+			sorted.Close()
+			return nil, err
+		}
+		chunk = nil
+	}
+
+	// The last chunk, or the only one, is kept in memory
+	sortChunk(chunk)
+	if err := sorted.merging.push(&sliceIterator{entries: chunk}); err != nil {
+		sorted.Close()
+		return nil, err
+	}
+
+	heap.Init(&sorted.merging)
+	return sorted, nil
+}
+
+// Writes a sorted chunk of entries to a temporary file, and adds it to the merge
+func (s *SortedEntries) writeChunk(chunk []keyedEntry, dir string) error {
+	file, err := ioutil.TempFile(dir, "ldifsort-*.ldif")
+	if err != nil {
+		return err
+	}
+	s.chunks = append(s.chunks, file)
+
+	writer := bufio.NewWriter(file)
+	for _, entry := range chunk {
+		if _, err := writer.WriteString(entry.String() + "\n"); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return s.merging.push(&readerIterator{reader: NewReader(file)})
+}
+
+// Next returns the next entry in order, or io.EOF
+func (s *SortedEntries) Next() (Entry, error) {
+	if s.merging.Len() == 0 {
+		return Entry{}, io.EOF
+	}
+	source := s.merging.sources[0]
+	entry := source.current
+	if err := source.advance(); err != nil && err != io.EOF {
+		return Entry{}, err
+	}
+	if source.done {
+		heap.Remove(&s.merging, 0)
+	} else {
+		heap.Fix(&s.merging, 0)
+	}
+	return entry.Entry, nil
+}
+
+// Close removes the temporary files
+func (s *SortedEntries) Close() error {
+	var firstErr error
+	for _, file := range s.chunks {
+		file.Close()
+		if err := os.Remove(file.Name()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.chunks = nil
+	return firstErr
+}
+
+// A sorted source of keyed entries for the merge
+type keyedIterator interface {
+	next() (keyedEntry, error)
+}
+
+type sliceIterator struct {
+	entries []keyedEntry
+}
+
+func (s *sliceIterator) next() (keyedEntry, error) {
+	if len(s.entries) == 0 {
+		return keyedEntry{}, io.EOF
+	}
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	return entry, nil
+}
+
+type readerIterator struct {
+	reader *Reader
+}
+
+func (r *readerIterator) next() (keyedEntry, error) {
+	entry, err := r.reader.Next()
+	if err != nil {
+		return keyedEntry{}, err
+	}
+	return newKeyedEntry(entry), nil
+}
+
+// A source in the merge, with the entry it is positioned on
+type mergeSource struct {
+	iterator keyedIterator
+	current  keyedEntry
+	done     bool
+}
+
+func (m *mergeSource) advance() error {
+	entry, err := m.iterator.next()
+	if err != nil {
+		m.done = true
+		return err
+	}
+	m.current = entry
+	return nil
+}
+
+// Heap of sources, by their current entry. Sources that are already finished are not added
+type mergeHeap struct {
+	sources []*mergeSource
+	reverse bool
+}
+
+// Adds a source before the heap is initialized. Empty sources are left out, and read errors returned
+func (h *mergeHeap) push(iterator keyedIterator) error {
+	source := &mergeSource{iterator: iterator}
+	err := source.advance()
+	switch {
+	case err == io.EOF:
+		return nil
+	case err != nil:
+		return err
+	}
+	h.sources = append(h.sources, source)
+	return nil
+}
+
+func (h mergeHeap) Len() int {
+	return len(h.sources)
+}
+
+func (h mergeHeap) Less(i, j int) bool {
+	return (compareDNKeys(h.sources[i].current.key, h.sources[j].current.key) < 0) != h.reverse
+}
+
+func (h mergeHeap) Swap(i, j int) {
+	h.sources[i], h.sources[j] = h.sources[j], h.sources[i]
+}
+
+func (h *mergeHeap) Push(x interface{}) {
+	h.sources = append(h.sources, x.(*mergeSource))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	last := h.sources[len(h.sources)-1]
+	h.sources = h.sources[:len(h.sources)-1]
+	return last
+}
+
+// Checks that the entries of an iterator are sorted, and not repeated
+type orderChecker struct {
+	entries  EntryIterator
+	previous []string
+	count    int
+}
+
+func (c *orderChecker) Next() (keyedEntry, error) {
+	entry, err := c.entries.Next()
+	if err != nil {
+		return keyedEntry{}, err
+	}
+	keyed := newKeyedEntry(entry)
+	if c.count > 0 && compareDNKeys(c.previous, keyed.key) >= 0 {
+		return keyedEntry{}, fmt.Errorf("%w: %s", ErrNotSorted, entry.DN)
+	}
+	c.previous = keyed.key
+	c.count++
+	return keyed, nil
+}
+
+// DiffStream compares two sequences of entries, sorted as returned by SortEntries, and calls emit
+// with each change as soon as it is found. Only the entries being compared are kept in memory
+// Adds and modifies are generated parents first. Deletes are sorted, leaf entries first, and
+// generated at the end. Ordered entries are not renamed, and the renames in the options are ignored
+func DiffStream(targetEntries EntryIterator, currentEntries EntryIterator, options Options, streamOptions StreamOptions, emit func(ChangeRecord) error) error {
+	target := &orderChecker{entries: targetEntries}
+	current := &orderChecker{entries: currentEntries}
+	deletes := &deleteCollector{}
+
+	targetEntry, targetErr := target.Next()
+	currentEntry, currentErr := current.Next()
+	for {
+		for _, err := range []error{targetErr, currentErr} {
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+		if targetErr == io.EOF && currentErr == io.EOF {
+			break
+		}
+
+		comparison := 0
+		switch {
+		case targetErr == io.EOF:
+			comparison = -1
+		case currentErr == io.EOF:
+			comparison = 1
+		default:
+			comparison = compareDNKeys(currentEntry.key, targetEntry.key)
+		}
+
+		switch comparison {
+		case -1:
+			deletes.entries = append(deletes.entries, Entry{DN: currentEntry.DN})
+			currentEntry, currentErr = current.Next()
+		case 1:
+			if err := emit(ChangeRecord{DN: targetEntry.DN, ChangeType: ChangeAdd, Attributes: targetEntry.Attributes}); err != nil {
+				return err
+			}
+			targetEntry, targetErr = target.Next()
+		default:
+			if change, changed := diffEntry(targetEntry.Entry, currentEntry.Entry, options); changed {
+				if err := emit(change); err != nil {
+					return err
+				}
+			}
+			targetEntry, targetErr = target.Next()
+			currentEntry, currentErr = current.Next()
+		}
+
+		// Deletes are sorted in chunks, as any other entries
+		if len(deletes.entries) >= streamOptions.ChunkSize && streamOptions.ChunkSize > 0 {
+			if err := deletes.flush(streamOptions); err != nil {
+				deletes.close()
+				return err
+			}
+		}
+	}
+
+	defer deletes.close()
+	sortedDeletes, err := deletes.sorted(streamOptions)
+	if err != nil {
+		return err
+	}
+	for {
+		entry, err := sortedDeletes.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := emit(ChangeRecord{DN: entry.DN, ChangeType: ChangeDelete}); err != nil {
+			return err
+		}
+	}
+}
+
+// Keeps the DNs of the entries to delete, in temporary files when there are many
+type deleteCollector struct {
+	entries []Entry
+	files   []*os.File
+	result  *SortedEntries
+}
+
+// Writes the collected entries to a temporary file
+func (d *deleteCollector) flush(options StreamOptions) error {
+	file, err := ioutil.TempFile(options.TempDir, "ldifdeletes-*.ldif")
+	if err != nil {
+		return err
+	}
+	d.files = append(d.files, file)
+	writer := bufio.NewWriter(file)
+	for _, entry := range d.entries {
+		if _, err := writer.WriteString(entry.String() + "\n"); err != nil {
+			return err
+		}
+	}
+	d.entries = nil
+	return writer.Flush()
+}
+
+// Returns the collected entries, children before their parents
+func (d *deleteCollector) sorted(options StreamOptions) (*SortedEntries, error) {
+	var iterators []EntryIterator
+	for _, file := range d.files {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		iterators = append(iterators, NewReader(file))
+	}
+	iterators = append(iterators, &entrySliceIterator{entries: d.entries})
+
+	var err error
+	d.result, err = sortEntries(&concatIterator{iterators: iterators}, options, true)
+	return d.result, err
+}
+
+func (d *deleteCollector) close() {
+	if d.result != nil {
+		d.result.Close()
+	}
+	for _, file := range d.files {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	d.files = nil
+}
+
+type entrySliceIterator struct {
+	entries []Entry
+}
+
+func (s *entrySliceIterator) Next() (Entry, error) {
+	if len(s.entries) == 0 {
+		return Entry{}, io.EOF
+	}
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	return entry, nil
+}
+
+// Returns the entries of several iterators, one after the other
+type concatIterator struct {
+	iterators []EntryIterator
+}
+
+func (c *concatIterator) Next() (Entry, error) {
+	for len(c.iterators) > 0 {
+		entry, err := c.iterators[0].Next()
+		if err != io.EOF {
+			return entry, err
+		}
+		c.iterators = c.iterators[1:]
+	}
+	return Entry{}, io.EOF
+}
@@ -0,0 +1,132 @@
+package ldif
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Generates an unsorted ldif of a tree with some random people, groups and attributes
+func randomTree(random *rand.Rand) string {
+	var entries []string
+	entries = append(entries, "dn: dc=example,dc=com\nobjectClass: domain\ndc: example\n")
+	for _, ou := range []string{"people", "groups", "apps", "hosts"} {
+		if random.Intn(4) == 0 {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("dn: ou=%s,dc=example,dc=com\nobjectClass: organizationalUnit\nou: %s\n", ou, ou))
+		for i := 0; i < 30; i++ {
+			if random.Intn(3) == 0 {
+				continue
+			}
+			entry := fmt.Sprintf("dn: cn=item%d,ou=%s,dc=example,dc=com\nobjectClass: device\ncn: item%d\n", i, ou, i)
+			for _, description := range random.Perm(3)[:random.Intn(3)] {
+				entry += fmt.Sprintf("description: %d\n", description)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	random.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+	return strings.Join(entries, "\n")
+}
+
+func TestDiffStream(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "streamtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		target, current := randomTree(random), randomTree(random)
+		targetEntries, _ := Parse(strings.NewReader(target))
+		currentEntries, _ := Parse(strings.NewReader(current))
+
+		// Small chunks, so that the entries are sorted using temporary files
+		streamOptions := StreamOptions{ChunkSize: 7, TempDir: tempDir}
+		sortedTarget, err := SortEntries(NewReader(strings.NewReader(target)), streamOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sortedCurrent, err := SortEntries(NewReader(strings.NewReader(current)), streamOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var changes []ChangeRecord
+		err = DiffStream(sortedTarget, sortedCurrent, DefaultOptions(), streamOptions, func(change ChangeRecord) error {
+			changes = append(changes, change)
+			return nil
+		})
+		sortedTarget.Close()
+		sortedCurrent.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The same changes as in memory, in an order that can be applied
+		expected := DiffWithOptions(targetEntries, currentEntries, DefaultOptions())
+		if got, want := sortedChanges(changes), sortedChanges(expected); got != want {
+			t.Fatalf("Case %d: expected changes\n%s\ngot\n%s", i, want, got)
+		}
+		result, err := Apply(currentEntries, changes, DefaultOptions())
+		if err != nil {
+			t.Fatalf("Case %d: could not apply changes: %v\n%s", i, err, FormatChanges(changes))
+		}
+		if remaining := Diff(targetEntries, result); len(remaining) > 0 {
+			t.Fatalf("Case %d: differences after applying changes\n%s", i, FormatChanges(remaining))
+		}
+	}
+
+	files, _ := ioutil.ReadDir(tempDir)
+	if len(files) > 0 {
+		t.Errorf("Temporary files not removed: %d", len(files))
+	}
+}
+
+func sortedChanges(changes []ChangeRecord) string {
+	records := make([]string, len(changes))
+	for i, change := range changes {
+		records[i] = change.String()
+	}
+	sort.Strings(records)
+	return strings.Join(records, "\n")
+}
+
+func TestDiffStreamNotSorted(t *testing.T) {
+	ldif := `
+dn: ou=people,dc=example,dc=com
+ou: people
+
+dn: dc=example,dc=com
+dc: example
+`
+	err := DiffStream(NewReader(strings.NewReader(ldif)), NewReader(strings.NewReader("")), DefaultOptions(), DefaultStreamOptions(),
+		func(ChangeRecord) error { return nil })
+	if !errors.Is(err, ErrNotSorted) {
+		t.Errorf("Expected ErrNotSorted, got %v", err)
+	}
+}
+
+// Fails reading its first entry
+type failingIterator struct{}
+
+func (failingIterator) next() (keyedEntry, error) {
+	return keyedEntry{}, errors.New("read error")
+}
+
+func TestMergeReadError(t *testing.T) {
+	merging := mergeHeap{}
+	if err := merging.push(&sliceIterator{}); err != nil || merging.Len() != 0 {
+		t.Errorf("Empty source not left out: %v", err)
+	}
+	if err := merging.push(failingIterator{}); err == nil || err.Error() != "read error" {
+		t.Errorf("Expected the read error, got %v", err)
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"math/rand"
 	"strings"
 	"testing"
+
+	"example.com/ldifCompare/ldif"
 )
 
 var currentLdif = `
@@ -259,7 +262,15 @@ result: 0 Success
 `
 
 func TestLdifCompare(t *testing.T) {
-	ldapModify := compareLdif(parseLdif(newLdif), parseLdif(currentLdif))
+	newEntries, err := ldif.Parse(strings.NewReader(newLdif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentEntries, err := ldif.Parse(strings.NewReader(currentLdif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ldapModify := ldif.FormatChanges(ldif.Diff(newEntries, currentEntries))
 
 	fmt.Println("hello")
 	fmt.Println(ldapModify)
@@ -296,3 +307,188 @@ func TestLdifCompare(t *testing.T) {
 		t.Fatal("Missing", "dn: olcDatabase={2}monitor,cn=config\nchangetype: delete")
 	}
 }
+
+// Applying the changes generated from current to new, on current, must give new
+func TestLdifCompareApply(t *testing.T) {
+	inputs := [][2]string{{newLdif, currentLdif}, {currentLdif, newLdif}}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		inputs = append(inputs, [2]string{randomConfig(random), randomConfig(random)})
+	}
+
+	for i, input := range inputs {
+		newEntries, err := ldif.Parse(strings.NewReader(input[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		currentEntries, err := ldif.Parse(strings.NewReader(input[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, mode := range []ldif.ReplaceMode{ldif.ReplaceKnown, ldif.ReplaceAll, ldif.ReplaceNever} {
+			options := ldif.DefaultOptions()
+			options.Replace = mode
+			if mode == ldif.ReplaceAll {
+				options.RenameSimilarity = 0.5
+			}
+			ldapModify := ldif.FormatChanges(ldif.DiffWithOptions(newEntries, currentEntries, options))
+
+			changes, err := ldif.ParseChanges(strings.NewReader(ldapModify))
+			if err != nil {
+				t.Fatalf("Input %d: could not parse changes: %v\n%s", i, err, ldapModify)
+			}
+			result, err := ldif.Apply(currentEntries, changes, options)
+			if err != nil {
+				t.Fatalf("Input %d: could not apply changes: %v\n%s\nCurrent:\n%s", i, err, ldapModify, currentEntries)
+			}
+			if remaining := ldif.Diff(newEntries, result); len(remaining) > 0 {
+				t.Fatalf("Input %d: result differs from new:\n%s\nChanges:\n%s\nCurrent:\n%s\nNew:\n%s", i, ldif.FormatChanges(remaining), ldapModify, currentEntries, newEntries)
+			}
+		}
+	}
+}
+
+// Generates a random cn=config, with databases and overlays that get renumbered, ordered
+// olcAccess values and a data subtree
+func randomConfig(random *rand.Rand) string {
+	var builder strings.Builder
+
+	pick := func(pool []string, max int) []string {
+		var picked []string
+		for _, i := range random.Perm(len(pool))[:random.Intn(max+1)] {
+			picked = append(picked, pool[i])
+		}
+		return picked
+	}
+
+	builder.WriteString("dn: cn=config\nobjectClass: olcGlobal\ncn: config\n")
+	for _, v := range pick([]string{"stats", "sync", "acl", "none"}, 2) {
+		builder.WriteString("olcLogLevel: " + v + "\n")
+	}
+	for _, v := range pick([]string{"lang-", "x-", "phonetic-"}, 3) {
+		builder.WriteString("olcAttributeOptions: " + v + "\n")
+	}
+	if random.Intn(2) == 0 {
+		builder.WriteString("olcIdleTimeout: " + fmt.Sprint(random.Intn(3)) + "\n")
+	}
+	builder.WriteString("\n")
+
+	databases := append([]string{"frontend", "config"}, pick([]string{"mdb", "monitor", "ldif", "relay", "null"}, 4)...)
+	accessRules := []string{
+		"to attrs=userPassword by self write by * auth",
+		"to * by * read",
+		"to dn.base=\"\" by * read",
+		"to dn.subtree=\"ou=people,dc=example,dc=com\" by users read",
+		"to * by self write",
+	}
+	overlays := []string{"syncprov", "accesslog", "ppolicy", "memberof"}
+	for i, database := range databases {
+		dn := fmt.Sprintf("olcDatabase={%d}%s,cn=config", i-1, database)
+		fmt.Fprintf(&builder, "dn: %s\nobjectClass: olcDatabaseConfig\nolcDatabase: {%d}%s\n", dn, i-1, database)
+		for j, rule := range pick(accessRules, len(accessRules)) {
+			fmt.Fprintf(&builder, "olcAccess: {%d}%s\n", j, rule)
+		}
+		for _, index := range pick([]string{"objectClass eq", "uid eq,sub", "cn eq"}, 3) {
+			builder.WriteString("olcDbIndex: " + index + "\n")
+		}
+		if random.Intn(2) == 0 {
+			builder.WriteString("olcReadOnly: " + []string{"TRUE", "FALSE"}[random.Intn(2)] + "\n")
+		}
+		builder.WriteString("\n")
+		for j, overlay := range pick(overlays, 3) {
+			fmt.Fprintf(&builder, "dn: olcOverlay={%d}%s,%s\nobjectClass: olcOverlayConfig\nolcOverlay: {%d}%s\n\n", j, overlay, dn, j, overlay)
+		}
+	}
+
+	if random.Intn(3) > 0 {
+		builder.WriteString("dn: dc=example,dc=com\nobjectClass: domain\ndc: example\n\n")
+		for _, ou := range pick([]string{"people", "groups", "services"}, 3) {
+			fmt.Fprintf(&builder, "dn: ou=%s,dc=example,dc=com\nobjectClass: organizationalUnit\nou: %s\n\n", ou, ou)
+			for _, uid := range pick([]string{"alice", "bob", "carol"}, 3) {
+				fmt.Fprintf(&builder, "dn: uid=%s,ou=%s,dc=example,dc=com\nobjectClass: account\nuid: %s\n", uid, ou, uid)
+				for _, mail := range pick([]string{uid + "@example.com", uid + "@example.org"}, 2) {
+					builder.WriteString("mail: " + mail + "\n")
+				}
+				builder.WriteString("\n")
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// Generates a data ldif with the specified number of people, in random order. The seed selects
+// the values of some attributes, so that two ldifs with different seeds have differences
+func randomDirectory(people int, seed int64) string {
+	random := rand.New(rand.NewSource(seed))
+	entries := []string{
+		"dn: dc=example,dc=com\nobjectClass: domain\ndc: example\n",
+		"dn: ou=people,dc=example,dc=com\nobjectClass: organizationalUnit\nou: people\n",
+	}
+	for i := 0; i < people; i++ {
+		if random.Intn(20) == 0 {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("dn: uid=user%d,ou=people,dc=example,dc=com\nobjectClass: inetOrgPerson\n"+
+			"uid: user%d\ncn: User %d\nsn: %d\nmail: user%d@example.com\ntelephoneNumber: +34 600 %06d\n",
+			i, i, i, i, i, random.Intn(10)))
+	}
+	random.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+	return strings.Join(entries, "\n")
+}
+
+// Throughput of the comparison in memory, in bytes of both ldifs per second
+func BenchmarkDiff(b *testing.B) {
+	current, new := randomDirectory(20000, 1), randomDirectory(20000, 2)
+	b.SetBytes(int64(len(current) + len(new)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		currentEntries, _ := ldif.Parse(strings.NewReader(current))
+		newEntries, _ := ldif.Parse(strings.NewReader(new))
+		ldif.DiffWithOptions(newEntries, currentEntries, ldif.DefaultOptions())
+	}
+}
+
+// Throughput of the streaming comparison, sorting in chunks of 1000 entries in temporary files
+func BenchmarkDiffStream(b *testing.B) {
+	current, new := randomDirectory(20000, 1), randomDirectory(20000, 2)
+	streamOptions := ldif.StreamOptions{ChunkSize: 1000, TempDir: b.TempDir()}
+	b.SetBytes(int64(len(current) + len(new)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		currentEntries, err := ldif.SortEntries(ldif.NewReader(strings.NewReader(current)), streamOptions)
+		if err != nil {
+			b.Fatal(err)
+		}
+		newEntries, err := ldif.SortEntries(ldif.NewReader(strings.NewReader(new)), streamOptions)
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = ldif.DiffStream(newEntries, currentEntries, ldif.DefaultOptions(), streamOptions, func(ldif.ChangeRecord) error { return nil })
+		currentEntries.Close()
+		newEntries.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Throughput of the streaming comparison of files already sorted
+func BenchmarkDiffStreamPresorted(b *testing.B) {
+	sorted := func(text string) string {
+		entries, _ := ldif.Parse(strings.NewReader(text))
+		return entries.String()
+	}
+	current, new := sorted(randomDirectory(20000, 1)), sorted(randomDirectory(20000, 2))
+	b.SetBytes(int64(len(current) + len(new)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := ldif.DiffStream(ldif.NewReader(strings.NewReader(new)), ldif.NewReader(strings.NewReader(current)),
+			ldif.DefaultOptions(), ldif.DefaultStreamOptions(), func(ldif.ChangeRecord) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,99 +1,113 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"sort"
 	"strings"
+
+	"example.com/ldifCompare/ldif"
 )
 
-// ---------------------- Types
+var currentConfigFiles stringList
+var newConfigFiles stringList
+var newConfigDirPtr = flag.String("new-dir", "", "slapd.d directory with the configuration to apply, instead of -new")
+var newConfigConfPtr = flag.String("new-conf", "", "slapd.conf file with the configuration to apply, converted using slaptest, instead of -new")
+var slaptestPtr = flag.String("slaptest", ldif.SlaptestCommand, "Path to the slaptest command")
+var replaceModePtr = flag.String("replace", "known", "Attributes to change using replace: known (single valued cn=config attributes), single (also attributes with one value in each side), all or never")
+var schemaFilePtr = flag.String("schema", "", "Ldif file with attribute type definitions (olcAttributeTypes or attributeTypes), used to compare values")
+var ignoreFilePtr = flag.String("ignore-file", "", "File with attributes to ignore in both sides, one per line, as <attribute> [under <dn pattern>]")
+var noDefaultIgnorePtr = flag.Bool("no-default-ignore", false, "Do not ignore the operational attributes (entryCSN, modifyTimestamp...)")
+var ignoreAttrs stringList
+var renames stringList
+var sensitiveAttrs stringList
+var basePtr = flag.String("base", "", "Only compares the entries in this subtree, as in ldapsearch -b. By default, all the entries")
+var scopePtr = flag.String("scope", "sub", "Scope of the entries to compare under -base: base, one or sub")
+var excludeSubtrees stringList
+var filterPtr = flag.String("filter", "", "Only compares the entries that match this LDAP filter in any side, as in (!(objectClass=olcSchemaConfig))")
+var renameSimilarityPtr = flag.Float64("rename-similarity", 0, "Renames, instead of deleting and adding, the entries whose attributes, not counting the RDN, are at least this similar (0 to 1) to a new entry. 0 disables it")
+var formatPtr = flag.String("format", "ldif", "Output format: ldif (ldapmodify changes), json or yaml (description of the changes, with the values added and removed)")
+var reportPtr = flag.String("report", "", "Writes, instead of the changes, a report for reviewers, grouped by entry, in html or md (markdown) format. Passwords are masked")
+var summaryPtr = flag.Bool("summary", false, "Writes only the number of entries added, deleted, modified and renamed, in the -format specified")
+var mergeBasePtr = flag.String("merge-base", "", "File with the configuration last applied. If specified, only the changes from it to new are applied to current, keeping the changes made live")
+var conflictsPtr = flag.String("conflicts", "fail", "With -merge-base, how to resolve attributes changed both live and in new: fail, live (keep current values) or desired (apply new values)")
+var streamPtr = flag.Bool("stream", false, "Compares the files without loading them in memory, sorting them using temporary files. For big ldifs, such as slapcat exports")
+var presortedPtr = flag.Bool("presorted", false, "With -stream, the files are already sorted, parents first, and are not sorted again")
+var sortChunkPtr = flag.Int("sort-chunk", ldif.DefaultStreamOptions().ChunkSize, "With -stream, number of entries sorted in memory at a time")
+var tempDirPtr = flag.String("temp-dir", "", "With -stream, directory for the temporary files. By default, the system one")
+var checkPtr = flag.Bool("check", false, "Only reports whether there are differences, without writing the changes")
+var rollbackFilePtr = flag.String("rollback-out", "", "File where the changes to undo the ones generated are written")
+var isDebug = flag.Bool("debug", false, "Writes tracing information in stdout")
+var help = flag.Bool("help", false, "Shows help")
 
-////////////////////////////////////////////////////
-// Represents an entry in the ldap tree
-type ldapEntry struct {
-	dn         string
-	attributes map[string][]string
-}
+// Exit codes
+const (
+	exitNoChanges = 0 // No differences found
+	exitChanges   = 1 // Differences found, or errors found by lint
+	exitError     = 2 // Any error, including invalid parameters
+)
 
-func (e ldapEntry) serializeDN() string {
-	return fmt.Sprintf("dn: %s\n", e.dn)
+func init() {
+	flag.Var(&currentConfigFiles, "current", "File with current configuration. Mandatory. May be repeated, and be a directory, with .ldif files or in slapd.d format, or a glob pattern")
+	flag.Var(&newConfigFiles, "new", "File with configuration to apply, as -current. If not specified, new config is read from standard input")
+	flag.Var(&ignoreAttrs, "ignore-attr", "Attribute to ignore in both sides, as <attribute> [under <dn pattern>]. May be repeated")
+	flag.Var(&excludeSubtrees, "exclude-subtree", "DN of an entry that, with all its descendants, is not compared. May be repeated")
+	flag.Var(&sensitiveAttrs, "sensitive-attr", "Attribute whose values are redacted in every output but the changes, in addition to passwords, private keys and credentials= fields. May be repeated")
+	flag.Var(&renames, "rename", "Entry to rename with a modrdn, as \"<current dn> => <new dn>\". May be repeated")
 }
 
-func (e ldapEntry) serializeAttributes() string {
-	var builder strings.Builder
-	for name, values := range e.attributes {
-		for _, value := range values {
-			builder.WriteString(fmt.Sprintf("%s: %s\n", name, value))
-		}
-	}
-	return builder.String()
-}
+// Implementation of flag.Value for flags that may be repeated
+type stringList []string
 
-func (e ldapEntry) serialize() string {
-	return e.serializeDN() + e.serializeAttributes()
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
 }
 
-// Gets the ldapentry attributes, as a string slice, sorted
-func (e ldapEntry) getSortedAttributes() []string {
-	attributesAsStrings := make([]string, 0)
-	for k, vv := range e.attributes {
-		for _, v := range vv {
-			attributesAsStrings = append(attributesAsStrings, fmt.Sprintf("%s: %s", k, v))
-		}
-	}
-	sort.Strings(attributesAsStrings)
-
-	return attributesAsStrings
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
-/////////////////////////////////////////////////////
-type ldapEntryList []ldapEntry
+/*
+Takes as an input two files with ldif format (current and new), compares them and generates as
+standard output the commands to use in ldapmodify to change from current to new.
 
-// Methods of the Interface interface for sorting based on dn
-func (l ldapEntryList) Len() int {
-	return len(l)
-}
+The new configuration may also be specified as a slapd.d directory or slapd.conf file. Both
+configurations may be split in several files, directories and glob patterns, which are merged. An
+entry may be in several files only if it is equal in all of them
 
-// Sort order for dn is defined the oposite as lexicographic order, to have the leaf entries
-// before
-func (l ldapEntryList) Less(i, j int) bool {
-	return l[i].dn > l[j].dn
-}
+Passwords, private keys, credentials= fields and the -sensitive-attr attributes are redacted in every
+output, as it may end up in logs, except in the changes themselves
 
-func (l ldapEntryList) Swap(i, j int) {
-	l[i], l[j] = l[j], l[i]
-}
+With -stream, big files are compared without loading them in memory (see stream.go)
 
-// Helper implementing the stringer interface
-func (l ldapEntryList) String() string {
-	var builder strings.Builder
-	for _, entry := range l {
-		builder.WriteString(fmt.Sprintf("dn: %s\n", entry.dn))
-		for _, nv := range entry.getSortedAttributes() {
-			builder.WriteString(fmt.Sprintln(nv))
-		}
-		builder.WriteString("\n")
-	}
-	return builder.String()
-}
+ldifCompare convert [-dir <slapd.d directory> | -conf <slapd.conf file>] writes the configuration in ldif format
 
-// ---------------------- End types
+ldifCompare patch -changes <change file> [-current <ldif file>] applies the changes to the entries and writes the result
 
-var currentConfigFilePtr = flag.String("current", "", "File with current configuration. Mandatory")
-var newConfigFilePtr = flag.String("new", "", "File with configuration to apply. If not specified, new config is read from standard input")
-var isDebug = flag.Bool("debug", false, "Writes tracing information in stdout")
-var help = flag.Bool("help", false, "Shows help")
+ldifCompare lint [-in <ldif file>] [-schema <schema ldif>] checks an ldif, or a change file, and writes the problems found
 
-/*
-Takes as an input two files with ldif format (current and new), compares them and generates as
-standard output the commands to use in ldapmodify to change from current to new.
+Exit code is 0 if there are no differences, 1 if there are, and 2 if there is any error. With -check,
+only the exit code and a message are generated, so that scripts can skip ldapmodify if nothing changed
 */
 func main() {
 
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		convertMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "patch" {
+		patchMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		lintMain(os.Args[2:])
+		return
+	}
+
 	// Treat command line parameters
 	flag.Parse()
 
@@ -105,274 +119,276 @@ func main() {
 		return
 	}
 
-	if *currentConfigFilePtr == "" {
+	if len(currentConfigFiles) == 0 {
 		fmt.Println("[ERROR] current config file not specified")
+		os.Exit(exitError)
+	}
+
+	if *formatPtr != "ldif" && *formatPtr != "json" && *formatPtr != "yaml" {
+		fmt.Println("[ERROR] invalid format ", *formatPtr, ". Expected ldif, json or yaml")
+		os.Exit(exitError)
+	}
+
+	if *reportPtr != "" && *reportPtr != "html" && *reportPtr != "md" {
+		fmt.Println("[ERROR] invalid report format ", *reportPtr, ". Expected html or md")
+		os.Exit(exitError)
+	}
+
+	replaceMode, e := ldif.ParseReplaceMode(*replaceModePtr)
+	if e != nil {
+		fmt.Println("[ERROR] ", e.Error())
+		os.Exit(exitError)
+	}
+
+	ignoreRules, e := readIgnoreRules()
+	if e != nil {
+		fmt.Println("[ERROR] ", e.Error())
+		os.Exit(exitError)
+	}
+
+	mergePolicy, e := ldif.ParseMergePolicy(*conflictsPtr)
+	if e != nil {
+		fmt.Println("[ERROR] ", e.Error())
+		os.Exit(exitError)
+	}
+
+	selection, e := readSelection()
+	if e != nil {
+		fmt.Println("[ERROR] ", e.Error())
+		os.Exit(exitError)
+	}
+
+	redaction := ldif.DefaultRedaction()
+	redaction.Attributes = append(redaction.Attributes, sensitiveAttrs...)
+
+	options := ldif.DefaultOptions()
+	options.Replace = replaceMode
+	options.RenameSimilarity = *renameSimilarityPtr
+	for _, text := range renames {
+		rename, e := ldif.ParseRename(text)
+		if e != nil {
+			fmt.Println("[ERROR] ", e.Error())
+			os.Exit(exitError)
+		}
+		options.Renames = append(options.Renames, rename)
+	}
+	if *schemaFilePtr != "" {
+		if e := loadSchema(options.Schema, *schemaFilePtr); e != nil {
+			fmt.Println("[ERROR] Could not load schema: ", e.Error())
+			os.Exit(exitError)
+		}
+	}
+
+	if *streamPtr {
+		streamMain(options, ignoreRules, selection, redaction)
 		return
 	}
 
-	// Read input file with current configuration
-	currentFileBytes, e := ioutil.ReadFile(*currentConfigFilePtr)
+	// Read current configuration, merging all the files
+	currentLdapEntries, e := ldif.ReadFiles(currentConfigFiles, options.Schema)
 	if e != nil {
-		fmt.Println("[ERROR] Could not read input file ", *currentConfigFilePtr)
-		os.Exit(1)
+		fmt.Println("[ERROR] Could not read current configuration: ", redaction.Error(e, options.Schema))
+		os.Exit(exitError)
 	}
 
-	// Read new configuration, from file or from standard input
-	var newFileBytes []byte
-	if *newConfigFilePtr == "" {
+	// Read new configuration, from slapd.d directory, slapd.conf, files or from standard input
+	ldif.SlaptestCommand = *slaptestPtr
+	newLdapEntries, e := readConfig(*newConfigDirPtr, *newConfigConfPtr)
+	if e != nil {
+		fmt.Println("[ERROR] Could not read new configuration: ", redaction.Error(e, options.Schema))
+		os.Exit(exitError)
+	}
+
+	switch {
+	case newLdapEntries != nil:
+		// Already read from slapd.d directory or slapd.conf
+	case len(newConfigFiles) == 0:
 		// Read from standard input
-		newFileBytes, e = ioutil.ReadAll(os.Stdin)
+		newFileBytes, e := ioutil.ReadAll(os.Stdin)
 		if e != nil {
 			fmt.Println("[ERROR] Error Reading input: ", e.Error())
-			os.Exit(1)
+			os.Exit(exitError)
 		}
-	} else {
-		newFileBytes, e = ioutil.ReadFile(*newConfigFilePtr)
+		newLdapEntries, e = ldif.Parse(bytes.NewReader(newFileBytes))
+		if e != nil {
+			fmt.Println("[ERROR] Could not parse new configuration: ", redaction.Error(e, options.Schema))
+			os.Exit(exitError)
+		}
+	default:
+		newLdapEntries, e = ldif.ReadFiles(newConfigFiles, options.Schema)
 		if e != nil {
-			fmt.Println("[ERROR] Could not read input file ", *newConfigFilePtr)
-			os.Exit(1)
+			fmt.Println("[ERROR] Could not read new configuration: ", redaction.Error(e, options.Schema))
+			os.Exit(exitError)
 		}
 	}
 
-	// Read input ldiff
-	currentLdapEntries := parseLdif(string(currentFileBytes))
+	// Remove the ignored attributes in both sides
+	ignoreRules.Apply(currentLdapEntries)
+	ignoreRules.Apply(newLdapEntries)
 
-	// Read new ldiff
-	newLdapEntries := parseLdif(string(newFileBytes))
+	// Keep only the entries to compare
+	newLdapEntries, currentLdapEntries, e = selection.Apply(newLdapEntries, currentLdapEntries, options.Schema)
+	if e != nil {
+		fmt.Println("[ERROR] ", e.Error())
+		os.Exit(exitError)
+	}
 
-	// For debugging. Print contents of current file
+	// Three-way merge. The changes made live since the last applied configuration are kept
+	if *mergeBasePtr != "" {
+		newLdapEntries, e = mergeWithBase(*mergeBasePtr, currentLdapEntries, newLdapEntries, ignoreRules, selection, mergePolicy, redaction, options.Schema)
+		if e != nil {
+			fmt.Println("[ERROR] ", redaction.Error(e, options.Schema))
+			os.Exit(exitError)
+		}
+	}
+
+	// For debugging. Print contents of current file, without secrets, as the output may be logged
 	if *isDebug {
 		fmt.Println("==== Current ==========================================")
-		fmt.Println(currentLdapEntries)
+		fmt.Println(redaction.Entries(currentLdapEntries, options.Schema))
 		fmt.Print("=======================================================\n\n")
 		fmt.Println("==== New  =============================================")
-		fmt.Println(newLdapEntries)
+		fmt.Println(redaction.Entries(newLdapEntries, options.Schema))
 		fmt.Print("=======================================================\n\n")
 	}
 
-	fmt.Println(compareLdif(newLdapEntries, currentLdapEntries))
-}
-
-// Helper function to read a ldif file and generate an ldapEntryList
-// The results are ordered by dn and also inside each entry, by attribute
-func parseLdif(ldif string) ldapEntryList {
-
-	lineScanner := bufio.NewScanner(strings.NewReader(ldif))
-
-	ldapEntries := make(ldapEntryList, 0)
-
-	var currentLdapEntry *ldapEntry
-
-	// Iterate through entries
-	for lineScanner.Scan() {
-
-		line := strings.TrimSpace(lineScanner.Text())
-
-		// Ignore comments
-		if len(line) > 0 && line[0] == '#' {
-			continue
-		}
-
-		// Blank line. May mark the end of the entry. If so, add to entries and mark current entry as nil
-		if len(line) == 0 {
-			if currentLdapEntry != nil {
-				// Add entry only if dn is not empty. Otherwise ignore
-				if currentLdapEntry.dn != "" {
-					// Add to the list of entries
-					ldapEntries = append(ldapEntries, *currentLdapEntry)
-				}
-				currentLdapEntry = nil
-			}
-			continue
+	changes := ldif.DiffWithOptions(newLdapEntries, currentLdapEntries, options)
+	if *checkPtr {
+		if len(changes) == 0 {
+			fmt.Println("No differences found")
+			os.Exit(exitNoChanges)
 		}
+		fmt.Println("Differences found:", len(changes), "changes")
+		os.Exit(exitChanges)
+	}
 
-		// Regular line. Append to current
-		// Create entry if it was not existing yet
-		if currentLdapEntry == nil {
-			currentLdapEntry = &ldapEntry{
-				attributes: make(map[string][]string),
-			}
+	// Write the changes to undo the update, in case it has to be rolled back
+	if *rollbackFilePtr != "" {
+		rollback := ldif.FormatChanges(ldif.Rollback(newLdapEntries, currentLdapEntries, options))
+		if e := ioutil.WriteFile(*rollbackFilePtr, []byte(rollback), 0600); e != nil {
+			fmt.Println("[ERROR] Could not write rollback file: ", e.Error())
+			os.Exit(exitError)
 		}
+	}
 
-		// A line MUST be of the form attrName: AttrValue-posibly-including other ":""
-		// This function will leave the ":" at the end, which is later removed using "TrimSuffix"
-		attrAndValue := strings.SplitAfterN(line, ":", 2)
-		if len(attrAndValue) != 2 {
-			fmt.Println("[ERROR] Line not valid: ", line)
-			os.Exit(1)
+	if *reportPtr != "" {
+		review, e := ldif.NewReview(changes, currentLdapEntries, options, redaction)
+		if e != nil {
+			fmt.Println("[ERROR] Could not describe changes: ", e.Error())
+			os.Exit(exitError)
 		}
-		attr := strings.TrimSpace(strings.TrimSuffix(attrAndValue[0], ":"))
-		value := strings.TrimSpace(attrAndValue[1])
-
-		if attr == "dn" {
-			// Add the dn
-			if currentLdapEntry.dn != "" {
-				fmt.Println("[ERROR] Entry with two dn ", line)
-				os.Exit(1)
-			} else {
-				currentLdapEntry.dn = value
-			}
+		if *reportPtr == "html" {
+			fmt.Print(review.HTML())
 		} else {
-			// Add an attribute
-			// If non existing, crete a slice with a single value
-			// If existing, append to the slice
-			currentValue := currentLdapEntry.attributes[attr]
-			if currentValue == nil {
-				currentLdapEntry.attributes[attr] = []string{value}
-			} else {
-				currentLdapEntry.attributes[attr] = append(currentLdapEntry.attributes[attr], value)
-			}
+			fmt.Print(review.Markdown())
 		}
-	}
-
-	// Treat the possibly last entry
-	if currentLdapEntry != nil {
-		// Add entry only if dn is not empty. Otherwise ignore
-		if currentLdapEntry.dn != "" {
-			ldapEntries = append(ldapEntries, *currentLdapEntry)
+	} else if *formatPtr == "ldif" && !*summaryPtr {
+		fmt.Println(ldif.FormatChanges(changes))
+	} else {
+		report, e := ldif.NewReport(changes, currentLdapEntries, options)
+		if e != nil {
+			fmt.Println("[ERROR] Could not describe changes: ", e.Error())
+			os.Exit(exitError)
+		}
+		report = redaction.Report(report, options.Schema)
+		switch {
+		case *summaryPtr && *formatPtr == "ldif":
+			fmt.Print(report.Summary)
+		case *summaryPtr && *formatPtr == "json":
+			fmt.Print(report.Summary.JSON())
+		case *summaryPtr && *formatPtr == "yaml":
+			fmt.Print(report.Summary.YAML())
+		case *formatPtr == "json":
+			fmt.Print(report.JSON())
+		case *formatPtr == "yaml":
+			fmt.Print(report.YAML())
 		}
 	}
 
-	// Sort the entries (reverse order)
-	sort.Sort(ldapEntries)
-
-	return ldapEntries
+	if len(changes) > 0 {
+		os.Exit(exitChanges)
+	}
 }
 
-// Generates an ldapmodify spec to make changes from currentLdif to targetLdif
-func compareLdif(targetLdif ldapEntryList, currentLdif ldapEntryList) string {
-	currentPos := 0
-	targetPos := 0
-
-	var builder strings.Builder
-
-	// Target & Current are ldapentries(dn + attributes)
-	// Target exists
-	//	Current exists
-	//	  compare entries
-	//  Current does not exist
-	//	  add
-	// Target does not exist
-	//	Current exists
-	//	  delete
-	//  Current does not exist
-	//	  break
-
-	var operation string
-	for {
-		if targetPos < len(targetLdif) {
-			if currentPos < len(currentLdif) {
-				// Sort order for dn is defined the oposite as lexicographic order, to have the leaf entries
-				// before (see func Less)
-				if currentLdif[currentPos].dn > targetLdif[targetPos].dn {
-					operation = "delete"
-				} else if currentLdif[currentPos].dn < targetLdif[targetPos].dn {
-					operation = "add"
-				} else {
-					operation = "compare"
-				}
-			} else {
-				operation = "add"
-			}
-		} else {
-			if currentPos < len(currentLdif) {
-				operation = "delete"
-			} else {
-				break
-			}
-		}
+// Reads the last applied configuration, and merges the changes from it to the new configuration
+// with the current one. Conflicts are written in standard error, redacted
+func mergeWithBase(baseFile string, current ldif.EntryList, desired ldif.EntryList, ignoreRules ldif.IgnoreRules,
+	selection ldif.Selection, policy ldif.MergePolicy, redaction ldif.Redaction, schema *ldif.Schema) (ldif.EntryList, error) {
 
-		switch operation {
-		case "add":
-			builder.WriteString(targetLdif[targetPos].serializeDN())
-			builder.WriteString("changetype: add\n")
-			builder.WriteString(targetLdif[targetPos].serializeAttributes())
-			builder.WriteString("\n")
-			targetPos++
-		case "compare":
-			builder.WriteString(compareEntry(targetLdif[targetPos], currentLdif[currentPos]))
-			currentPos++
-			targetPos++
-		case "delete":
-			builder.WriteString(currentLdif[currentPos].serializeDN())
-			builder.WriteString("changetype: delete\n")
-			builder.WriteString("\n")
-			currentPos++
-		}
+	base, e := ldif.ReadFiles([]string{baseFile}, schema)
+	if e != nil {
+		return nil, fmt.Errorf("could not read base configuration: %w", e)
+	}
+	ignoreRules.Apply(base)
+	base, _, e = selection.Apply(base, current, schema)
+	if e != nil {
+		return nil, e
 	}
 
-	return builder.String()
+	merged, conflicts, e := ldif.Merge(base, current, desired, policy, schema)
+	for _, conflict := range conflicts {
+		fmt.Fprintln(os.Stderr, "[CONFLICT]", redaction.Conflict(conflict, schema))
+	}
+	return merged, e
 }
 
-// Generates an ldapmodify spec to make changes from the currentEntry attributes to the targetEntry attributes
-func compareEntry(targetEntry ldapEntry, currentEntry ldapEntry) string {
-	currentPos := 0
-	targetPos := 0
-	isEmpty := true
-
-	var targetAttributes = targetEntry.getSortedAttributes()
-	var currentAttributes = currentEntry.getSortedAttributes()
-
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("dn: %s\n", targetEntry.dn))
-	builder.WriteString("changetype: modify\n")
-
-	var operation string
-	for {
-		if targetPos < len(targetAttributes) {
-			if currentPos < len(currentAttributes) {
-				if currentAttributes[currentPos] < targetAttributes[targetPos] {
-					operation = "delete"
-				} else if currentAttributes[currentPos] > targetAttributes[targetPos] {
-					operation = "add"
-				} else {
-					operation = "continue"
-				}
-			} else {
-				operation = "add"
-			}
-		} else {
-			if currentPos < len(currentAttributes) {
-				operation = "delete"
-			} else {
-				break
-			}
+// Builds the selection of entries to compare from the -base, -scope, -exclude-subtree and -filter flags
+func readSelection() (ldif.Selection, error) {
+	scope, e := ldif.ParseScope(*scopePtr)
+	if e != nil {
+		return ldif.Selection{}, e
+	}
+	selection := ldif.Selection{Base: *basePtr, Scope: scope, Exclude: excludeSubtrees}
+	if *filterPtr != "" {
+		if selection.Filter, e = ldif.ParseFilter(*filterPtr); e != nil {
+			return selection, e
 		}
+	}
+	return selection, nil
+}
 
-		switch operation {
-		case "add":
-			if !isEmpty {
-				builder.WriteString("-\n")
-			}
-			builder.WriteString(fmt.Sprintf("add: %s\n", getAttributeName(targetAttributes[targetPos])))
-			builder.WriteString(targetAttributes[targetPos])
-			builder.WriteString("\n")
-			targetPos++
-			isEmpty = false
-		case "continue":
-			currentPos++
-			targetPos++
-		case "delete":
-			if !isEmpty {
-				builder.WriteString("-\n")
-			}
-			builder.WriteString(fmt.Sprintf("delete: %s\n", getAttributeName(currentAttributes[currentPos])))
-			builder.WriteString(currentAttributes[currentPos])
-			builder.WriteString("\n")
-			currentPos++
-			isEmpty = false
+// Builds the list of attributes to ignore from the defaults, the ignore file and the -ignore-attr flags
+func readIgnoreRules() (ldif.IgnoreRules, error) {
+	rules := make(ldif.IgnoreRules, 0)
+	if !*noDefaultIgnorePtr {
+		rules = append(rules, ldif.DefaultIgnoreRules()...)
+	}
+
+	if *ignoreFilePtr != "" {
+		ignoreFile, e := os.Open(*ignoreFilePtr)
+		if e != nil {
+			return nil, e
 		}
+		defer ignoreFile.Close()
+		fileRules, e := ldif.ParseIgnoreRules(ignoreFile)
+		if e != nil {
+			return nil, fmt.Errorf("%s: %w", *ignoreFilePtr, e)
+		}
+		rules = append(rules, fileRules...)
 	}
 
-	if isEmpty {
-		return ""
-	} else {
-		builder.WriteString("\n")
-		return builder.String()
+	for _, text := range ignoreAttrs {
+		rule, e := ldif.ParseIgnoreRule(text)
+		if e != nil {
+			return nil, e
+		}
+		rules = append(rules, rule)
 	}
+
+	return rules, nil
 }
 
-func getAttributeName(attrString string) string {
-	kv := strings.Split(attrString, ":")
-	return strings.TrimSpace(kv[0])
+// Adds the attribute type definitions in the ldif file to the schema
+func loadSchema(schema *ldif.Schema, schemaFile string) error {
+	file, e := os.Open(schemaFile)
+	if e != nil {
+		return e
+	}
+	defer file.Close()
+
+	entries, e := ldif.Parse(file)
+	if e != nil {
+		return e
+	}
+	return schema.LoadSchema(entries)
 }
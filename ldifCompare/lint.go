@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"example.com/ldifCompare/ldif"
+)
+
+/*
+Implements the lint subcommand. Checks an ldif with entries, or with change records, and writes all
+the problems found, one per line. Exit code is 0 if there are no errors (there may be warnings),
+1 if there are errors, and 2 if the file could not be read.
+*/
+func lintMain(args []string) {
+	lintFlags := flag.NewFlagSet("lint", flag.ExitOnError)
+	inputPtr := lintFlags.String("in", "", "Ldif file to check. If not specified, it is read from standard input")
+	schemaPtr := lintFlags.String("schema", "", "Ldif file with attribute type definitions. If specified, attributes not defined in it are reported")
+	strictPtr := lintFlags.Bool("strict", false, "Warnings are also errors")
+	lintFlags.Parse(args)
+
+	var input io.Reader = os.Stdin
+	if *inputPtr != "" {
+		inputFile, e := os.Open(*inputPtr)
+		if e != nil {
+			fmt.Println("[ERROR] Could not read input file ", *inputPtr)
+			os.Exit(exitError)
+		}
+		defer inputFile.Close()
+		input = inputFile
+	}
+
+	options := ldif.LintOptions{Schema: ldif.DefaultSchema(), Redaction: ldif.DefaultRedaction()}
+	if *schemaPtr != "" {
+		options.Defined = ldif.NewSchema()
+		for _, schema := range []*ldif.Schema{options.Schema, options.Defined} {
+			if e := loadSchema(schema, *schemaPtr); e != nil {
+				fmt.Println("[ERROR] Could not load schema: ", e.Error())
+				os.Exit(exitError)
+			}
+		}
+	}
+
+	problems, e := ldif.Lint(input, options)
+	if e != nil {
+		fmt.Println("[ERROR] Could not read ldif: ", e.Error())
+		os.Exit(exitError)
+	}
+
+	errors := 0
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if problem.Severity == ldif.SeverityError || *strictPtr {
+			errors++
+		}
+	}
+	if errors > 0 {
+		os.Exit(exitChanges)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"example.com/ldifCompare/ldif"
+)
+
+/*
+Implements the patch subcommand (ldifPatch). Applies an ldapmodify change file to the entries of a
+content ldif, in memory, and writes the resulting ldif. Used to check the generated changes without
+a running slapd.
+*/
+func patchMain(args []string) {
+	patchFlags := flag.NewFlagSet("patch", flag.ExitOnError)
+	inputPtr := patchFlags.String("current", "", "Ldif file with the entries to change. If not specified, it is read from standard input")
+	changesPtr := patchFlags.String("changes", "", "Ldif file with the change records, as used by ldapmodify. Mandatory")
+	outputPtr := patchFlags.String("out", "", "File where the resulting ldif is written. If not specified, it is written in standard output")
+	schemaPtr := patchFlags.String("schema", "", "Ldif file with attribute type definitions, used to match values")
+	patchFlags.Parse(args)
+
+	if *changesPtr == "" {
+		fmt.Println("[ERROR] -changes must be specified")
+		os.Exit(exitError)
+	}
+
+	options := ldif.DefaultOptions()
+	if *schemaPtr != "" {
+		if e := loadSchema(options.Schema, *schemaPtr); e != nil {
+			fmt.Println("[ERROR] Could not load schema: ", e.Error())
+			os.Exit(exitError)
+		}
+	}
+
+	// Values in parse errors are redacted, as in ldifCompare
+	redaction := ldif.DefaultRedaction()
+
+	var input io.Reader = os.Stdin
+	if *inputPtr != "" {
+		inputFile, e := os.Open(*inputPtr)
+		if e != nil {
+			fmt.Println("[ERROR] Could not read input file ", *inputPtr)
+			os.Exit(exitError)
+		}
+		defer inputFile.Close()
+		input = inputFile
+	}
+	entries, e := ldif.Parse(input)
+	if e != nil {
+		fmt.Println("[ERROR] Could not parse entries: ", redaction.Error(e, options.Schema))
+		os.Exit(exitError)
+	}
+
+	changesFile, e := os.Open(*changesPtr)
+	if e != nil {
+		fmt.Println("[ERROR] Could not read changes file ", *changesPtr)
+		os.Exit(exitError)
+	}
+	defer changesFile.Close()
+	changes, e := ldif.ParseChanges(changesFile)
+	if e != nil {
+		fmt.Println("[ERROR] Could not parse changes: ", redaction.Error(e, options.Schema))
+		os.Exit(exitError)
+	}
+
+	result, e := ldif.Apply(entries, changes, options)
+	if e != nil {
+		fmt.Println("[ERROR] Could not apply changes: ", e.Error())
+		os.Exit(exitError)
+	}
+
+	if *outputPtr == "" {
+		fmt.Print(result)
+		return
+	}
+	if e := ioutil.WriteFile(*outputPtr, []byte(result.String()), 0644); e != nil {
+		fmt.Println("[ERROR] Could not write output file: ", e.Error())
+		os.Exit(exitError)
+	}
+}
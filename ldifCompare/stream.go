@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"example.com/ldifCompare/ldif"
+)
+
+/*
+Implements the -stream mode, for big ldifs, such as slapcat exports. The entries are read one by
+one, sorted using temporary files unless -presorted is specified, and compared as they are read,
+so the memory used does not depend on the size of the files. The changes are written as they are
+found, with the deletes at the end. When there are several files, they are read one after the
+other, and an entry in several of them is an error.
+
+Renames, three-way merges, filters, rollback files, json or yaml reports and review reports are not supported, as
+they need all the entries in memory.
+*/
+func streamMain(options ldif.Options, ignoreRules ldif.IgnoreRules, selection ldif.Selection, redaction ldif.Redaction) {
+	switch {
+	case *newConfigDirPtr != "" || *newConfigConfPtr != "":
+		streamError("-new-dir and -new-conf are not supported with -stream")
+	case *mergeBasePtr != "":
+		streamError("-merge-base is not supported with -stream")
+	case selection.Filter != nil:
+		streamError("-filter is not supported with -stream")
+	case len(options.Renames) > 0 || options.RenameSimilarity > 0:
+		streamError("-rename and -rename-similarity are not supported with -stream")
+	case *rollbackFilePtr != "":
+		streamError("-rollback-out is not supported with -stream")
+	case *reportPtr != "":
+		streamError("-report is not supported with -stream")
+	case *formatPtr != "ldif" && !*summaryPtr:
+		streamError("only ldif format, or -summary, is supported with -stream")
+	}
+
+	streamOptions := ldif.StreamOptions{ChunkSize: *sortChunkPtr, TempDir: *tempDirPtr}
+
+	currentInput, e := openFiles(currentConfigFiles)
+	if e != nil {
+		streamError("Could not read current configuration: ", e.Error())
+	}
+	defer currentInput.Close()
+	var newInput io.Reader = os.Stdin
+	if len(newConfigFiles) > 0 {
+		newFiles, e := openFiles(newConfigFiles)
+		if e != nil {
+			streamError("Could not read new configuration: ", e.Error())
+		}
+		defer newFiles.Close()
+		newInput = newFiles
+	}
+
+	currentEntries, closeCurrent, e := streamEntries(currentInput, ignoreRules, selection, options.Schema, streamOptions)
+	if e != nil {
+		streamError("Could not sort current configuration: ", redaction.Error(e, options.Schema))
+	}
+	defer closeCurrent()
+	newEntries, closeNew, e := streamEntries(newInput, ignoreRules, selection, options.Schema, streamOptions)
+	if e != nil {
+		closeCurrent()
+		streamError("Could not sort new configuration: ", redaction.Error(e, options.Schema))
+	}
+	defer closeNew()
+
+	output := bufio.NewWriter(os.Stdout)
+	summary := ldif.ReportSummary{}
+	e = ldif.DiffStream(newEntries, currentEntries, options, streamOptions, func(change ldif.ChangeRecord) error {
+		switch change.ChangeType {
+		case ldif.ChangeAdd:
+			summary.Added++
+		case ldif.ChangeDelete:
+			summary.Deleted++
+		default:
+			summary.Modified++
+		}
+		if *checkPtr || *summaryPtr {
+			return nil
+		}
+		_, err := output.WriteString(change.String())
+		return err
+	})
+	if e != nil {
+		closeCurrent()
+		closeNew()
+		streamError("Could not compare configurations: ", redaction.Error(e, options.Schema))
+	}
+
+	changes := summary.Added + summary.Deleted + summary.Modified
+	switch {
+	case *checkPtr && changes == 0:
+		fmt.Fprintln(output, "No differences found")
+	case *checkPtr:
+		fmt.Fprintln(output, "Differences found:", changes, "changes")
+	case *summaryPtr && *formatPtr == "json":
+		output.WriteString(summary.JSON())
+	case *summaryPtr && *formatPtr == "yaml":
+		output.WriteString(summary.YAML())
+	case *summaryPtr:
+		output.WriteString(summary.String())
+	default:
+		output.WriteString("\n")
+	}
+	output.Flush()
+
+	if changes > 0 {
+		closeCurrent()
+		closeNew()
+		os.Exit(exitChanges)
+	}
+}
+
+// Returns the entries of the ldif, without the ignored attributes and the entries not selected,
+// sorted unless -presorted is specified. The returned function removes the temporary files
+func streamEntries(input io.Reader, ignoreRules ldif.IgnoreRules, selection ldif.Selection, schema *ldif.Schema,
+	streamOptions ldif.StreamOptions) (ldif.EntryIterator, func(), error) {
+
+	entries := &selectedEntries{reader: ldif.NewReader(input), ignoreRules: ignoreRules, selection: selection, schema: schema}
+	if *presortedPtr {
+		return entries, func() {}, nil
+	}
+	sorted, e := ldif.SortEntries(entries, streamOptions)
+	if e != nil {
+		return nil, nil, e
+	}
+	return sorted, func() { sorted.Close() }, nil
+}
+
+// The contents of several files, one after the other
+type multiFile struct {
+	io.Reader
+	files []*os.File
+}
+
+func (m *multiFile) Close() error {
+	for _, file := range m.files {
+		file.Close()
+	}
+	return nil
+}
+
+// Opens the ldif files in the paths (see ldif.ExpandPaths), to be read as one. The entries in
+// slapd.d directories have relative DNs, so they cannot be read this way
+func openFiles(paths []string) (*multiFile, error) {
+	for _, path := range paths {
+		if ldif.IsConfigDir(path) {
+			return nil, fmt.Errorf("slapd.d directory %s not supported with -stream", path)
+		}
+	}
+	files, e := ldif.ExpandPaths(paths)
+	if e != nil {
+		return nil, e
+	}
+
+	multi := &multiFile{}
+	var readers []io.Reader
+	for _, name := range files {
+		file, e := os.Open(name)
+		if e != nil {
+			multi.Close()
+			return nil, e
+		}
+		multi.files = append(multi.files, file)
+		// A blank line, in case the file does not end with one
+		readers = append(readers, file, strings.NewReader("\n\n"))
+	}
+	multi.Reader = io.MultiReader(readers...)
+	return multi, nil
+}
+
+// Reads the entries of an ldif, applying the ignore rules and the selection to each one
+type selectedEntries struct {
+	reader      *ldif.Reader
+	ignoreRules ldif.IgnoreRules
+	selection   ldif.Selection
+	schema      *ldif.Schema
+}
+
+func (s *selectedEntries) Next() (ldif.Entry, error) {
+	for {
+		entry, e := s.reader.Next()
+		if e != nil {
+			return entry, e
+		}
+		entries := ldif.EntryList{entry}
+		s.ignoreRules.Apply(entries)
+		if entries, _, e = s.selection.Apply(entries, nil, s.schema); e != nil {
+			return entry, e
+		}
+		if len(entries) > 0 {
+			return entries[0], nil
+		}
+	}
+}
+
+// Writes the error and exits. Temporary files must be removed before
+func streamError(message ...interface{}) {
+	fmt.Println("[ERROR]", fmt.Sprint(message...))
+	os.Exit(exitError)
+}
@@ -2,7 +2,7 @@
 
 SCRIPT_DIR="$(dirname $0 )"
 
-go build $SCRIPT_DIR/../ldifcompare.go
+(cd $SCRIPT_DIR/.. && go build -o ldifcompare .)
 
 # Option 1: File specifying new configuration
 $SCRIPT_DIR/../ldifcompare --current $SCRIPT_DIR/resources/current_ldif.txt --new $SCRIPT_DIR/resources/new_ldif.txt 
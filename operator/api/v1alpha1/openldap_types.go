@@ -31,6 +31,22 @@ type OpenldapSpec struct {
 	// Image to use
 	Image string `json:"image"`
 
+	// Role of the instances: provider, or read-only consumer of the provider in ProviderRef
+	// +kubebuilder:validation:Enum=provider;consumer
+	// +kubebuilder:default:=provider
+	// +optional
+	Role Role `json:"role,omitempty"`
+
+	// Provider to replicate from, for consumers
+	// +optional
+	ProviderRef *ProviderRef `json:"providerRef,omitempty"`
+
+	// Number of openldap instances, each one with its own database storage
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:default:=1
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
 	// Size of the database storage in GB
 	StorageSize resource.Quantity `json:"storage-size"`
 
@@ -42,19 +58,182 @@ type OpenldapSpec struct {
 
 	// Stores the openldap configuration
 	Config string `json:"config"`
+
+	// Replication between the openldap instances
+	// +optional
+	Replication ReplicationSpec `json:"replication,omitempty"`
+}
+
+// Role of the openldap instances
+type Role string
+
+const (
+	// The instances take writes
+	RoleProvider Role = "provider"
+	// The instances replicate from a provider, and refer writes to it
+	RoleConsumer Role = "consumer"
+)
+
+// ProviderRef is the provider of a consumer: an Openldap in the same cluster, or the URL of any other.
+// The provider needs the syncprov overlay, added with its replication, or in its configuration
+type ProviderRef struct {
+	// Name of the Openldap provider
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Namespace of the Openldap provider. By default, the namespace of the consumer
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// URL of the provider, such as ldap://ldap.example.com:389, for providers in other clusters. Used instead of Name
+	// +optional
+	URL string `json:"url,omitempty"`
 }
 
+// ReplicationMode is how the openldap instances replicate between them
+// +kubebuilder:validation:Enum=none;mirror;multiProvider
+type ReplicationMode string
+
+const (
+	// Each instance has its own data
+	ReplicationNone ReplicationMode = "none"
+	// All the instances replicate from each other, but writes should go to one of them at a time. The load
+	// balancer service sends the traffic to a single pod, and moves it to another ready pod when that one is not ready
+	ReplicationMirror ReplicationMode = "mirror"
+	// All the instances replicate from each other and take writes
+	ReplicationMultiProvider ReplicationMode = "multiProvider"
+)
+
+// ReplicationSpec defines the syncrepl replication between the openldap instances. The serverID,
+// syncrepl and syncprov directives are added to the configuration by the operator
+type ReplicationSpec struct {
+	// Replication mode: none, mirror or multiProvider. In mirror mode, the service sends the traffic to a
+	// single ready pod
+	// +kubebuilder:default:=none
+	// +optional
+	Mode ReplicationMode `json:"mode,omitempty"`
+
+	// Suffix of the database to replicate. By default, the first database with a suffix in the configuration
+	// +optional
+	Suffix string `json:"suffix,omitempty"`
+
+	// Name of a Secret with the binddn and password to bind to the providers. By default, the rootdn and
+	// rootpw of the database
+	// +optional
+	CredentialsSecret string `json:"credentials-secret,omitempty"`
+
+	// Domain of the kubernetes cluster, used in the URLs of the instances
+	// +kubebuilder:default:=cluster.local
+	// +optional
+	ClusterDomain string `json:"cluster-domain,omitempty"`
+}
+
+// Phase of an Openldap, summarizing its conditions
+type Phase string
+
+const (
+	// The resources are being created, or the pods are starting
+	PhasePending Phase = "Pending"
+	// All the pods are ready, with the configuration applied
+	PhaseReady Phase = "Ready"
+	// Running, but with some pods not ready, the configuration not applied or the storage not as requested
+	PhaseDegraded Phase = "Degraded"
+	// The configuration in the custom resource is not valid
+	PhaseFailed Phase = "Failed"
+)
+
+// Types of the conditions of an Openldap
+const (
+	// All the pods of the StatefulSet are ready
+	ConditionReady = "Ready"
+	// The configuration has been applied in all the pods
+	ConditionConfigApplied = "ConfigApplied"
+	// The PVCs of all the pods are bound, with the requested size
+	ConditionStorageReady = "StorageReady"
+	// The load balancer service has an address
+	ConditionServiceReady = "ServiceReady"
+	// Some of the other conditions failed while the Openldap is running
+	ConditionDegraded = "Degraded"
+)
+
 // OpenldapStatus defines the observed state of Openldap
 type OpenldapStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Node names of openldap pods
+	// Phase of the Openldap: Pending, Ready, Degraded or Failed
+	// +optional
+	Phase Phase `json:"phase,omitempty"`
+
+	// Generation of the Openldap the status is for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions: Ready, ConfigApplied, StorageReady, ServiceReady and Degraded
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Names of the openldap pods of the StatefulSet
 	Nodes []string `json:"nodes"`
+
+	// Address of the load balancer service
+	// +optional
+	LoadBalancerAddress string `json:"loadBalancerAddress,omitempty"`
+
+	// Hash of the last configuration applied in the pods
+	// +optional
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Error of the last configuration update. Empty if it was applied
+	// +optional
+	ConfigError string `json:"configError,omitempty"`
+
+	// Replication state of the consumers
+	// +optional
+	Replication *ReplicationStatus `json:"replication,omitempty"`
+}
+
+// ReplicationStatus is the replication state of the pods of a consumer, comparing their contextCSN with the one of the provider
+type ReplicationStatus struct {
+	// contextCSN of the provider
+	ProviderContextCSN []string `json:"providerContextCSN,omitempty"`
+
+	// Largest lag of the pods
+	Lag metav1.Duration `json:"lag"`
+
+	// State of each pod
+	Nodes []NodeReplicationStatus `json:"nodes,omitempty"`
+
+	// When the contextCSN were compared
+	LastCheck metav1.Time `json:"lastCheck"`
+}
+
+// NodeReplicationStatus is the replication state of a consumer pod
+type NodeReplicationStatus struct {
+	// Name of the pod
+	Name string `json:"name"`
+
+	// contextCSN of the pod
+	ContextCSN []string `json:"contextCSN,omitempty"`
+
+	// Time of the changes of the provider not yet in the pod, from the timestamps of the contextCSN
+	Lag metav1.Duration `json:"lag"`
+
+	// Why the contextCSN could not be read
+	// +optional
+	Error string `json:"error,omitempty"`
 }
 
 // Openldap is the Schema for the openldaps API
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Config",type=string,JSONPath=`.status.conditions[?(@.type=="ConfigApplied")].status`
+//+kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.spec.replicas`
+//+kubebuilder:printcolumn:name="Address",type=string,JSONPath=`.status.loadBalancerAddress`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type Openldap struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
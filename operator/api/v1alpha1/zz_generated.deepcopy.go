@@ -21,9 +21,31 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeReplicationStatus) DeepCopyInto(out *NodeReplicationStatus) {
+	*out = *in
+	if in.ContextCSN != nil {
+		in, out := &in.ContextCSN, &out.ContextCSN
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.Lag = in.Lag
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeReplicationStatus.
+func (in *NodeReplicationStatus) DeepCopy() *NodeReplicationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeReplicationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Openldap) DeepCopyInto(out *Openldap) {
 	*out = *in
@@ -86,7 +108,13 @@ func (in *OpenldapList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpenldapSpec) DeepCopyInto(out *OpenldapSpec) {
 	*out = *in
+	if in.ProviderRef != nil {
+		in, out := &in.ProviderRef, &out.ProviderRef
+		*out = new(ProviderRef)
+		**out = **in
+	}
 	out.StorageSize = in.StorageSize.DeepCopy()
+	out.Replication = in.Replication
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenldapSpec.
@@ -102,11 +130,23 @@ func (in *OpenldapSpec) DeepCopy() *OpenldapSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpenldapStatus) DeepCopyInto(out *OpenldapStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Nodes != nil {
 		in, out := &in.Nodes, &out.Nodes
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Replication != nil {
+		in, out := &in.Replication, &out.Replication
+		*out = new(ReplicationStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenldapStatus.
@@ -118,3 +158,62 @@ func (in *OpenldapStatus) DeepCopy() *OpenldapStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderRef) DeepCopyInto(out *ProviderRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderRef.
+func (in *ProviderRef) DeepCopy() *ProviderRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicationSpec) DeepCopyInto(out *ReplicationSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicationSpec.
+func (in *ReplicationSpec) DeepCopy() *ReplicationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicationStatus) DeepCopyInto(out *ReplicationStatus) {
+	*out = *in
+	if in.ProviderContextCSN != nil {
+		in, out := &in.ProviderContextCSN, &out.ProviderContextCSN
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.Lag = in.Lag
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]NodeReplicationStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.LastCheck.DeepCopyInto(&out.LastCheck)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicationStatus.
+func (in *ReplicationStatus) DeepCopy() *ReplicationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -19,19 +19,28 @@ package controllers
 import (
 	"context"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/tools/remotecommand"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	openldapv1alpha1 "ldapOperator/api/v1alpha1"
 
@@ -46,15 +55,28 @@ type OpenldapReconciler struct {
 	// Added for execution of commands
 	RESTClient rest.Interface
 	RESTConfig *rest.Config
+
+	// Reads objects from the API server instead of the cache
+	APIReader client.Reader
+
+	// Events of the Openldap objects, for kubectl describe
+	Recorder record.EventRecorder
+
+	// Restarts of the containers of the pods of each Openldap, to report new ones
+	restarts     map[types.NamespacedName]map[types.UID]int32
+	restartsLock sync.Mutex
 }
 
 //+kubebuilder:rbac:groups=openldap.minsait.com,resources=openldaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=openldap.minsait.com,resources=openldaps/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=openldap.minsait.com,resources=openldaps/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -66,7 +88,7 @@ type OpenldapReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
-func (r *OpenldapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *OpenldapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	log := ctrllog.FromContext(ctx)
 
 	log.Info("Reconcile", fmt.Sprintf("%v", ctx), fmt.Sprintf("%v", req))
@@ -77,6 +99,9 @@ func (r *OpenldapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		// Ignore this type of errors
 		if errors.IsNotFound(err) {
 			log.Info("Openldap object not found. Ignoring, since it might be deleted")
+			r.restartsLock.Lock()
+			delete(r.restarts, req.NamespacedName)
+			r.restartsLock.Unlock()
 			return ctrl.Result{}, nil
 		}
 		// Requeue
@@ -84,131 +109,255 @@ func (r *OpenldapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	// Create or update the Configmap with LDAP configuration
-	existingConfigMap := &corev1.ConfigMap{}
-	err := r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, existingConfigMap)
+	// The conditions are set at each step, and the status updated when returning
+	original := openldap.Status.DeepCopy()
+	defer func() {
+		if statusErr := r.updateStatus(ctx, openldap, original); statusErr != nil {
+			log.Error(statusErr, "Could not update status", "Namespace:", openldap.Namespace, "Name", openldap.Name)
+			if err == nil {
+				err = statusErr
+			}
+		}
+	}()
+
+	// Configuration of the pods, with the replication between them or from the provider
+	credentials, err := r.replicationCredentials(ctx, openldap)
+	if err != nil {
+		log.Error(err, "Could not read the replication credentials")
+		r.Recorder.Event(openldap, corev1.EventTypeWarning, "InvalidConfiguration", "Could not read the replication credentials: "+err.Error())
+		setCondition(openldap, openldapv1alpha1.ConditionConfigApplied, metav1.ConditionFalse, "InvalidConfiguration", err.Error())
+		return ctrl.Result{}, err
+	}
+	config, err := renderConfig(openldap, credentials)
+	if err != nil {
+		log.Error(err, "Invalid configuration for the replication")
+		r.Recorder.Event(openldap, corev1.EventTypeWarning, "InvalidConfiguration", err.Error())
+		setCondition(openldap, openldapv1alpha1.ConditionConfigApplied, metav1.ConditionFalse, "InvalidConfiguration", err.Error())
+		return ctrl.Result{}, err
+	}
+	hash := configHash(config)
+
+	// Create or update the Secret with LDAP configuration. It is a Secret, since the configuration has the
+	// replication credentials. Only the metadata of the secrets is cached, so the configuration is compared
+	// by the hash in its annotation
+	existingSecret := &metav1.PartialObjectMetadata{}
+	existingSecret.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+	err = r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, existingSecret)
 	if err != nil && errors.IsNotFound(err) {
-		// ConfigMap does not exist. Create it
-		configMap := r.configMapForOpenldap((openldap))
-		log.Info("About to create ConfigMap for Openldap")
-		if err := r.Create(ctx, configMap); err != nil {
-			log.Error(err, "Error creating Configmap")
+		// Secret does not exist. Create it
+		secret := r.configSecretForOpenldap(openldap, config)
+		log.Info("About to create configuration Secret for Openldap")
+		if err := r.Create(ctx, secret); err != nil {
+			log.Error(err, "Error creating configuration Secret")
+			r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "CreateFailed", "Could not create Secret %s: %s", secret.Name, err)
+			setCondition(openldap, openldapv1alpha1.ConditionConfigApplied, metav1.ConditionFalse, "SecretError", err.Error())
 			return ctrl.Result{}, err
 		}
-		// Configmap created. Return and requeue
+		r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "Created", "Created Secret %s", secret.Name)
+		// The pods will start with this configuration
+		openldap.Status.ConfigHash, openldap.Status.ConfigError = hash, ""
+		setCondition(openldap, openldapv1alpha1.ConditionConfigApplied, metav1.ConditionTrue, "SecretCreated", "The pods start with the configuration")
+		// Secret created. Return and requeue
 		return ctrl.Result{Requeue: true}, nil
 	} else if err != nil {
-		log.Error(err, "Failed to get Configmap")
+		log.Error(err, "Failed to get configuration Secret")
+		setCondition(openldap, openldapv1alpha1.ConditionConfigApplied, metav1.ConditionUnknown, "SecretError", err.Error())
 		return ctrl.Result{}, err
-	} else {
-		// Update configuration if it has changed in CR
-		if existingConfigMap.Data["slapd.conf"] != openldap.Spec.Config {
-			existingConfigMap.Data["slapd.conf"] = openldap.Spec.Config
-			log.Info("About to change configmap")
-			err := r.Update(ctx, existingConfigMap)
+	} else if existingSecret.GetAnnotations()[configHashAnnotation] != hash || openldap.Status.ConfigHash != hash {
+		// Update configuration if it has changed in CR, or the replicas have changed with replication. It is
+		// applied again if it failed last time
+		if existingSecret.GetAnnotations()[configHashAnnotation] != hash {
+			secret := r.configSecretForOpenldap(openldap, config)
+			secret.ResourceVersion = existingSecret.ResourceVersion
+			log.Info("About to change configuration Secret")
+			err := r.Update(ctx, secret)
 
 			if err != nil {
 				log.Error(err, "Could not update configuration")
+				r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "UpdateFailed", "Could not update Secret %s: %s", secret.Name, err)
+				setCondition(openldap, openldapv1alpha1.ConditionConfigApplied, metav1.ConditionFalse, "SecretError", err.Error())
 				return ctrl.Result{}, err
 			}
+		}
 
-			// Force update of configuration, since configmap contents will not be applied as configuration in the Openldap image
-			// This is done by executing a command in the pod, which takes the new config to apply through stdin
-			// https://github.com/kubernetes-sigs/kubebuilder/issues/803
-			existingPod := &corev1.Pod{}
-			err = r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, existingPod)
-			if err != nil && errors.IsNotFound(err) {
-				log.Info("The openldap pod does not exist yet")
-				return ctrl.Result{RequeueAfter: time.Minute}, nil
-			} else if err != nil {
-				log.Error(err, "Could not get the openLdap pod")
-				return ctrl.Result{}, err
-			}
-
-			req := r.RESTClient.Post().
-				Namespace(existingPod.Namespace).
-				Resource("pods").
-				Name(existingPod.Name).
-				SubResource("exec").
-				VersionedParams(&corev1.PodExecOptions{
-					Container: existingPod.Spec.Containers[0].Name,
-					Command:   []string{"/ldifCompare/bin/updateLdapConfig.sh"},
-					Stdin:     true,
-					Stdout:    true,
-					Stderr:    true,
-					TTY:       false,
-				}, runtime.NewParameterCodec(r.Scheme))
-
-			exec, err := remotecommand.NewSPDYExecutor(r.RESTConfig, "POST", req.URL())
-			if err != nil {
-				log.Error(err, "Could not build the remote command executor")
-				return ctrl.Result{}, err
+		// Force update of configuration, since secret contents will not be applied as configuration in the Openldap image
+		// This is done by executing a command in each pod, which takes the new config to apply through stdin
+		// https://github.com/kubernetes-sigs/kubebuilder/issues/803
+		podList, err := r.podsForOpenldap(ctx, openldap)
+		if err != nil {
+			log.Error(err, "Could not list the openLdap pods")
+			return ctrl.Result{}, err
+		}
+		if len(podList.Items) == 0 {
+			log.Info("The openldap pods do not exist yet")
+		}
+		for i := range podList.Items {
+			// Pods that are not running yet will start with the new configuration
+			if podList.Items[i].Status.Phase != corev1.PodRunning {
+				continue
 			}
-
-			in := strings.NewReader(openldap.Spec.Config)
-			out := strings.Builder{}
-			eout := strings.Builder{}
-
-			// Connect this process' std{in,out,err} to the remote shell process.
-			err = exec.Stream(remotecommand.StreamOptions{
-				Stdin:  in,
-				Stdout: &out,
-				Stderr: &eout,
-				Tty:    false,
-			})
-
+			summary, err := r.updateConfigInPod(ctx, &podList.Items[i], config)
 			if err != nil {
-				log.Error(err, "Could not execute update comand in LDAP pod")
+				log.Error(err, "Could not execute update comand in LDAP pod", "Pod", podList.Items[i].Name)
+				r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "ConfigApplyFailed", "Could not apply the configuration in pod %s: %s", podList.Items[i].Name, err)
+				openldap.Status.ConfigError = fmt.Sprintf("%s: %s", podList.Items[i].Name, err)
+				setCondition(openldap, openldapv1alpha1.ConditionConfigApplied, metav1.ConditionFalse, "ApplyFailed", openldap.Status.ConfigError)
 				return ctrl.Result{}, err
 			}
-
-			log.Info("Update Command executed")
-			log.Info("Stdout: " + out.String())
-			log.Info("Stderr: " + eout.String())
-
-			// Give some time to have the configmap update
-			return ctrl.Result{RequeueAfter: time.Minute}, nil
+			r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "ConfigApplied", "Configuration applied in pod %s: %s", podList.Items[i].Name, summary)
 		}
+		openldap.Status.ConfigHash, openldap.Status.ConfigError = hash, ""
+		setCondition(openldap, openldapv1alpha1.ConditionConfigApplied, metav1.ConditionTrue, "Applied", "The configuration has been applied in all the pods")
+
+		// Requeue at once, since the StatefulSet may have to be scaled to the replicas in the new configuration
+		return ctrl.Result{Requeue: true}, nil
 	}
 
-	// Create PVC if it does not exit
-	existingPVC := &corev1.PersistentVolumeClaim{}
-	err = r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, existingPVC)
+	// Create headless service if it does not exist. It gives a stable DNS name to each pod of the StatefulSet
+	existingHeadlessService := &corev1.Service{}
+	err = r.Get(ctx, types.NamespacedName{Name: headlessServiceName(openldap), Namespace: openldap.Namespace}, existingHeadlessService)
 	if err != nil && errors.IsNotFound(err) {
-		pvc := r.pvcForOpenLdap(openldap)
-		log.Info("About to create a PVC for Openldap")
-		if err := r.Create(ctx, pvc); err != nil {
-			log.Error(err, "Error creating PVC")
+		service := r.headlessServiceForOpenldap(openldap)
+		log.Info("About to create headless service for Openldap")
+		if err := r.Create(ctx, service); err != nil {
+			log.Error(err, "Failed creating headless service for Openldap")
+			r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "CreateFailed", "Could not create Service %s: %s", service.Name, err)
+			setCondition(openldap, openldapv1alpha1.ConditionServiceReady, metav1.ConditionFalse, "ServiceError", err.Error())
 			return ctrl.Result{}, err
 		}
-		// PVC created. Return and requeue
+		r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "Created", "Created headless Service %s", service.Name)
+		// Service created. Return and requeue
 		return ctrl.Result{Requeue: true}, nil
 	} else if err != nil {
-		log.Error(err, "Failed to get PVC")
+		log.Error(err, "Failed to get headless service")
+		setCondition(openldap, openldapv1alpha1.ConditionServiceReady, metav1.ConditionUnknown, "ServiceError", err.Error())
 		return ctrl.Result{}, err
-	} else {
-		// Check sizeRequests
-		if existingPVC.Spec.Resources.Requests["storage"] != openldap.Spec.StorageSize {
-			log.Error(err, "Existing PVC size does not match the requested one. You should consider deleting the existing PVC")
-			log.Info(fmt.Sprintf("#%v, #%v", existingPVC.Spec.Resources.Requests["storage"], openldap.Spec.StorageSize))
-			return ctrl.Result{}, err
-		}
 	}
 
-	// Create Pod if it does not exist
-	existingPod := &corev1.Pod{}
-	err = r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, existingPod)
+	// Previous versions ran a single pod, without StatefulSet
+	if err := r.removeLegacyPod(ctx, openldap); err != nil {
+		log.Error(err, "Could not delete the pod of the previous version")
+		return ctrl.Result{}, err
+	}
+
+	// Create StatefulSet if it does not exist
+	existingStatefulSet := &appsv1.StatefulSet{}
+	err = r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, existingStatefulSet)
 	if err != nil && errors.IsNotFound(err) {
-		pod := r.podForOpenldap(openldap)
-		log.Info("About to create a Pod for Openldap")
-		if err := r.Create(ctx, pod); err != nil {
-			log.Error(err, "Error creating Pod")
+		statefulSet := r.statefulSetForOpenldap(openldap)
+		log.Info("About to create a StatefulSet for Openldap")
+		if err := r.Create(ctx, statefulSet); err != nil {
+			log.Error(err, "Error creating StatefulSet")
+			r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "CreateFailed", "Could not create StatefulSet %s: %s", statefulSet.Name, err)
+			setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "StatefulSetError", err.Error())
 			return ctrl.Result{}, err
 		}
-		// Pod created. Return and requeue
+		r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "Created", "Created StatefulSet %s", statefulSet.Name)
+		setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "Creating", "The StatefulSet has been created")
+		setCondition(openldap, openldapv1alpha1.ConditionStorageReady, metav1.ConditionFalse, "Provisioning", "The PVCs are created with the pods")
+		// StatefulSet created. Return and requeue
 		return ctrl.Result{Requeue: true, RequeueAfter: 10 * time.Second}, nil
 	} else if err != nil {
-		log.Error(err, "Failed to get Pod")
+		log.Error(err, "Failed to get StatefulSet")
+		setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionUnknown, "StatefulSetError", err.Error())
+		return ctrl.Result{}, err
+	} else {
+		// Previous versions mounted the configuration from a ConfigMap
+		if migrated, err := r.migrateConfigVolume(ctx, openldap, existingStatefulSet); err != nil {
+			log.Error(err, "Could not mount the configuration from the Secret")
+			setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "StatefulSetError", err.Error())
+			return ctrl.Result{}, err
+		} else if migrated {
+			return ctrl.Result{Requeue: true}, nil
+		}
+
+		// Check sizeRequests. The volume claim templates of a StatefulSet cannot be changed
+		templateSize := existingStatefulSet.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests["storage"]
+		if templateSize.Cmp(openldap.Spec.StorageSize) != 0 {
+			log.Info("Existing PVC size does not match the requested one. You should consider deleting the StatefulSet and its PVCs")
+			log.Info(fmt.Sprintf("#%v, #%v", existingStatefulSet.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests["storage"], openldap.Spec.StorageSize))
+			message := fmt.Sprintf("The PVCs have %s, and %s is requested", templateSize.String(), openldap.Spec.StorageSize.String())
+			// Only once, not in every reconcile
+			if storage := meta.FindStatusCondition(openldap.Status.Conditions, openldapv1alpha1.ConditionStorageReady); storage == nil || storage.Reason != "SizeMismatch" {
+				r.Recorder.Event(openldap, corev1.EventTypeWarning, "StorageSizeMismatch", message+". Delete the StatefulSet and its PVCs to change it")
+			}
+			setCondition(openldap, openldapv1alpha1.ConditionStorageReady, metav1.ConditionFalse, "SizeMismatch", message)
+		}
+
+		// StatefulSets of previous versions listened on ldap:///, and slapd could not find its serverID
+		if container := &existingStatefulSet.Spec.Template.Spec.Containers[0]; !reflect.DeepEqual(container.Command, slapdCommand(openldap)) {
+			container.Command = slapdCommand(openldap)
+			log.Info("About to change the command of the pods")
+			if err := r.Update(ctx, existingStatefulSet); err != nil {
+				log.Error(err, "Could not update the StatefulSet")
+				r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "UpdateFailed", "Could not update StatefulSet %s: %s", existingStatefulSet.Name, err)
+				setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "StatefulSetError", err.Error())
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "Updated", "StatefulSet %s listens on the URLs of the instances", existingStatefulSet.Name)
+			return ctrl.Result{Requeue: true}, nil
+		}
+
+		// Scale if the number of replicas has changed in CR
+		replicas := replicasForOpenldap(openldap)
+		if existingStatefulSet.Spec.Replicas == nil || *existingStatefulSet.Spec.Replicas != replicas {
+			existingStatefulSet.Spec.Replicas = &replicas
+			log.Info("About to scale the StatefulSet", "Replicas", replicas)
+			if err := r.Update(ctx, existingStatefulSet); err != nil {
+				log.Error(err, "Could not scale the StatefulSet")
+				r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "ScaleFailed", "Could not scale StatefulSet %s: %s", existingStatefulSet.Name, err)
+				setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "StatefulSetError", err.Error())
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "Scaled", "Scaled StatefulSet %s to %d pods", existingStatefulSet.Name, replicas)
+			setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "Scaling", fmt.Sprintf("Scaling to %d pods", replicas))
+			return ctrl.Result{Requeue: true, RequeueAfter: 10 * time.Second}, nil
+		}
+	}
+
+	// The storage is ready when the PVCs of all the pods are bound, with the requested size
+	replicas := replicasForOpenldap(openldap)
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcList, client.InNamespace(openldap.Namespace), client.MatchingLabels(labelsForOpenldap(openldap))); err != nil {
+		log.Error(err, "Failed listing PVCs")
+		setCondition(openldap, openldapv1alpha1.ConditionStorageReady, metav1.ConditionUnknown, "PVCError", err.Error())
+		return ctrl.Result{}, err
+	}
+	templateSize := existingStatefulSet.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests["storage"]
+	if templateSize.Cmp(openldap.Spec.StorageSize) == 0 {
+		bound := int32(0)
+		for _, pvc := range pvcList.Items {
+			if pvc.Status.Phase == corev1.ClaimBound {
+				bound++
+			}
+		}
+		if bound >= replicas {
+			setCondition(openldap, openldapv1alpha1.ConditionStorageReady, metav1.ConditionTrue, "Bound", fmt.Sprintf("%d PVCs bound", bound))
+		} else {
+			setCondition(openldap, openldapv1alpha1.ConditionStorageReady, metav1.ConditionFalse, "Provisioning", fmt.Sprintf("%d of %d PVCs bound", bound, replicas))
+		}
+	}
+
+	// The PVCs created by the StatefulSet are kept when it is deleted. Mark them for deletion with the main object if so specified
+	if openldap.Spec.DisposePVC {
+		for i := range pvcList.Items {
+			pvc := &pvcList.Items[i]
+			if metav1.GetControllerOf(pvc) != nil {
+				continue
+			}
+			ctrl.SetControllerReference(openldap, pvc, r.Scheme)
+			log.Info("About to mark PVC for deletion with Openldap", "PVC", pvc.Name)
+			if err := r.Update(ctx, pvc); err != nil {
+				log.Error(err, "Could not update PVC")
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// Pods of the StatefulSet, for the service in mirror mode and the status
+	podList, err := r.podsForOpenldap(ctx, openldap)
+	if err != nil {
+		log.Error(err, "Failed listing pods", "Namespace:", openldap.Namespace, "Name", openldap.Name)
 		return ctrl.Result{}, err
 	}
 
@@ -217,48 +366,89 @@ func (r *OpenldapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	err = r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, existingService)
 	if err != nil && errors.IsNotFound(err) {
 		// Create the service
-		service := r.serviceForOpenldap(openldap)
+		service := r.serviceForOpenldap(openldap, podList.Items)
 		log.Info("About to create service for Openldap")
 		if err := r.Create(ctx, service); err != nil {
 			log.Error(err, "Failed creating service for Openldap")
+			r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "CreateFailed", "Could not create Service %s: %s", service.Name, err)
+			setCondition(openldap, openldapv1alpha1.ConditionServiceReady, metav1.ConditionFalse, "ServiceError", err.Error())
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "Created", "Created load balancer Service %s", service.Name)
+		setCondition(openldap, openldapv1alpha1.ConditionServiceReady, metav1.ConditionFalse, "AddressPending", "The load balancer service has been created")
 
 		// Service created. Return and requeue
 		return ctrl.Result{Requeue: true}, nil
 	} else if err != nil {
 		log.Error(err, "Failed to get service")
+		setCondition(openldap, openldapv1alpha1.ConditionServiceReady, metav1.ConditionUnknown, "ServiceError", err.Error())
 		return ctrl.Result{}, err
+	} else if selector := serviceSelector(openldap, existingService.Spec.Selector, podList.Items); !reflect.DeepEqual(existingService.Spec.Selector, selector) {
+		// The replication mode has changed, or in mirror mode the pod that takes the writes is not ready
+		existingService.Spec.Selector = selector
+		log.Info("About to change the pods of the service", "Selector", selector)
+		if err := r.Update(ctx, existingService); err != nil {
+			log.Error(err, "Could not update service")
+			setCondition(openldap, openldapv1alpha1.ConditionServiceReady, metav1.ConditionFalse, "ServiceError", err.Error())
+			return ctrl.Result{}, err
+		}
+		if writer := selector[podNameLabel]; writer != "" {
+			r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "WriterChanged", "Service %s sends the traffic to pod %s", existingService.Name, writer)
+		}
+		return ctrl.Result{Requeue: true}, nil
 	}
 
-	// Update status with pod names
-	podList := &corev1.PodList{}
-	listOpts := []client.ListOption{
-		client.InNamespace(openldap.Namespace),
-		client.MatchingLabels(map[string]string{"app": "openldap", "openldap": openldap.Name}),
+	// The service is ready when the load balancer has an address
+	openldap.Status.LoadBalancerAddress = ""
+	for _, ingress := range existingService.Status.LoadBalancer.Ingress {
+		if openldap.Status.LoadBalancerAddress = ingress.IP; ingress.IP == "" {
+			openldap.Status.LoadBalancerAddress = ingress.Hostname
+		}
+		break
 	}
-	if err := r.List(ctx, podList, listOpts...); err != nil {
-		log.Error(err, "Failed listing pods", "Namespace:", openldap.Namespace, "Name", openldap.Name)
-		return ctrl.Result{}, err
+	if openldap.Status.LoadBalancerAddress != "" {
+		setCondition(openldap, openldapv1alpha1.ConditionServiceReady, metav1.ConditionTrue, "AddressAssigned", "Listening in "+openldap.Status.LoadBalancerAddress)
+	} else {
+		setCondition(openldap, openldapv1alpha1.ConditionServiceReady, metav1.ConditionFalse, "AddressPending", "The load balancer has no address yet")
+	}
+
+	// Ready when all the pods of the StatefulSet are
+	ready := existingStatefulSet.Status.ReadyReplicas
+	switch {
+	case ready >= replicas:
+		setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionTrue, "PodsReady", fmt.Sprintf("%d of %d pods ready", ready, replicas))
+	case ready > 0:
+		setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "PartiallyReady", fmt.Sprintf("%d of %d pods ready", ready, replicas))
+	default:
+		setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "PodsNotReady", fmt.Sprintf("0 of %d pods ready", replicas))
 	}
+
+	// Update status with the names of the pods of the StatefulSet
 	var podNames []string
 	for _, pod := range podList.Items {
 		podNames = append(podNames, pod.Name)
 	}
-
-	// Update if required
-	if !reflect.DeepEqual(openldap.Status.Nodes, podNames) {
-		openldap.Status.Nodes = podNames
-		if err := r.Status().Update(ctx, openldap); err != nil {
-			log.Error(err, "Could not update status", "Namespace:", openldap.Namespace, "Name", openldap.Name)
-			return ctrl.Result{}, err
+	sort.Strings(podNames)
+
+	openldap.Status.Nodes = podNames
+	r.recordRestarts(openldap, podList.Items)
+
+	// Consumers also report how far behind the provider they are, checking again every minute
+	if openldap.Spec.Role == openldapv1alpha1.RoleConsumer {
+		// Not checked again before, since a status update is also a change of the Openldap that is reconciled
+		result.RequeueAfter = time.Minute
+		if last := openldap.Status.Replication; last == nil || time.Since(last.LastCheck.Time) >= time.Minute {
+			openldap.Status.Replication = r.replicationStatus(ctx, openldap, podList.Items, credentials)
+		} else {
+			result.RequeueAfter = time.Minute - time.Since(last.LastCheck.Time)
 		}
-
+	} else {
+		openldap.Status.Replication = nil
 	}
 
 	log.Info("Nothing to Reconcile")
 
-	return ctrl.Result{}, nil
+	return result, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -266,115 +456,485 @@ func (r *OpenldapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&openldapv1alpha1.Openldap{}).
 		// TODO: Check what happens if I remove some of the Owns
-		Owns(&corev1.Pod{}).Owns(&corev1.Service{}).Owns(&corev1.PersistentVolumeClaim{}).Owns(&corev1.ConfigMap{}).
+		Owns(&appsv1.StatefulSet{}).Owns(&corev1.Service{}).Owns(&corev1.PersistentVolumeClaim{}).
+		// Only the metadata of the secrets is cached, not their data
+		Owns(&corev1.Secret{}, builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.openldapsForSecret), builder.OnlyMetadata).
 		Complete(r)
 }
 
-// Creates the configmap
-func (r *OpenldapReconciler) configMapForOpenldap(openldap *openldapv1alpha1.Openldap) *corev1.ConfigMap {
-	configMap := &corev1.ConfigMap{
+// Openldaps that take the replication credentials from a secret, to reconcile when it changes
+func (r *OpenldapReconciler) openldapsForSecret(secret client.Object) []reconcile.Request {
+	openldapList := &openldapv1alpha1.OpenldapList{}
+	if err := r.List(context.Background(), openldapList, client.InNamespace(secret.GetNamespace())); err != nil {
+		ctrllog.Log.Error(err, "Could not list the Openldaps of the secret", "Secret", secret.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, openldap := range openldapList.Items {
+		if openldap.Spec.Replication.CredentialsSecret == secret.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: openldap.Name, Namespace: openldap.Namespace}})
+		}
+	}
+	return requests
+}
+
+// Annotation of the configuration secret with the hash of the configuration
+const configHashAnnotation = "openldap.minsait.com/config-hash"
+
+// Creates the secret with the configuration
+func (r *OpenldapReconciler) configSecretForOpenldap(openldap *openldapv1alpha1.Openldap, config string) *corev1.Secret {
+	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "openldap-" + openldap.Name,
-			Namespace: openldap.Namespace,
+			Name:        "openldap-" + openldap.Name,
+			Namespace:   openldap.Namespace,
+			Annotations: map[string]string{configHashAnnotation: configHash(config)},
 		},
-		Data: map[string]string{
-			"slapd.conf": openldap.Spec.Config,
+		Data: map[string][]byte{
+			"slapd.conf": []byte(config),
 		},
 	}
-	ctrl.SetControllerReference(openldap, configMap, r.Scheme)
-	return configMap
+	ctrl.SetControllerReference(openldap, secret, r.Scheme)
+	return secret
 }
 
-// Creates the ldap pod
-func (r *OpenldapReconciler) podForOpenldap(openldap *openldapv1alpha1.Openldap) *corev1.Pod {
-	pod := &corev1.Pod{
+// Volume of the pods with the configuration
+func configVolumeSource(openldap *openldapv1alpha1.Openldap) corev1.VolumeSource {
+	return corev1.VolumeSource{
+		Secret: &corev1.SecretVolumeSource{
+			SecretName: "openldap-" + openldap.Name,
+		},
+	}
+}
+
+// Finds the configuration volume in the pod template of the StatefulSet
+func configVolume(statefulSet *appsv1.StatefulSet) *corev1.Volume {
+	for i := range statefulSet.Spec.Template.Spec.Volumes {
+		if statefulSet.Spec.Template.Spec.Volumes[i].Name == "ldap-config" {
+			return &statefulSet.Spec.Template.Spec.Volumes[i]
+		}
+	}
+	return nil
+}
+
+// Labels of the pods, and of the PVCs, of an Openldap
+func labelsForOpenldap(openldap *openldapv1alpha1.Openldap) map[string]string {
+	return map[string]string{"app": "openldap", "openldap": openldap.Name}
+}
+
+// Number of replicas. Objects created before the field existed have 0, which means 1
+func replicasForOpenldap(openldap *openldapv1alpha1.Openldap) int32 {
+	if openldap.Spec.Replicas < 1 {
+		return 1
+	}
+	return openldap.Spec.Replicas
+}
+
+// Name of the headless service of the StatefulSet
+func headlessServiceName(openldap *openldapv1alpha1.Openldap) string {
+	return "openldap-" + openldap.Name + "-headless"
+}
+
+// Lists the pods of the StatefulSet. Other pods with the same labels, as the one of previous versions, are left out
+func (r *OpenldapReconciler) podsForOpenldap(ctx context.Context, openldap *openldapv1alpha1.Openldap) (*corev1.PodList, error) {
+	podList := &corev1.PodList{}
+	listOpts := []client.ListOption{
+		client.InNamespace(openldap.Namespace),
+		client.MatchingLabels(labelsForOpenldap(openldap)),
+	}
+	if err := r.List(ctx, podList, listOpts...); err != nil {
+		return podList, err
+	}
+	pods := podList.Items[:0]
+	for _, pod := range podList.Items {
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "StatefulSet" && owner.Name == "openldap-"+openldap.Name {
+			pods = append(pods, pod)
+		}
+	}
+	podList.Items = pods
+	return podList, nil
+}
+
+// Deletes the pod openldap-<name> created by previous versions, which would get the traffic of the service
+// along with the pods of the StatefulSet.
+// Its PVC, openldap-<name>, is kept with the data, since the pods of the StatefulSet have their own PVCs,
+// ldap-database-volume-openldap-<name>-<n>. To keep the data, either:
+//   - Export it with slapcat before upgrading, and import it with ldapadd in the new pods
+//   - Or scale the StatefulSet to 0, set the reclaim policy of the volume of the old PVC to Retain, delete
+//     the old PVC and ldap-database-volume-openldap-<name>-0, remove the claimRef of the volume, and create
+//     ldap-database-volume-openldap-<name>-0 again with volumeName set to the volume
+func (r *OpenldapReconciler) removeLegacyPod(ctx context.Context, openldap *openldapv1alpha1.Openldap) error {
+	log := ctrllog.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, pod)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if owner := metav1.GetControllerOf(pod); owner == nil || owner.UID != openldap.UID {
+		return nil
+	}
+
+	log.Info("About to delete the pod of the previous version", "Pod", pod.Name)
+	if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "Deleted", "Deleted Pod %s of the previous version, replaced by the StatefulSet", pod.Name)
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	err = r.Get(ctx, types.NamespacedName{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}, pvc)
+	if err == nil {
+		r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "LegacyPVC",
+			"PVC %s of the previous version is kept with its data, which is not in the StatefulSet. Import it with slapcat and ldapadd, or bind its volume to ldap-database-volume-openldap-%s-0",
+			pvc.Name, openldap.Name)
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Mounts the configuration from the Secret in StatefulSets of previous versions, which mounted it from the
+// ConfigMap openldap-<name>, and deletes the ConfigMap. The pods are restarted by the StatefulSet. Returns
+// whether the StatefulSet has been updated
+func (r *OpenldapReconciler) migrateConfigVolume(ctx context.Context, openldap *openldapv1alpha1.Openldap, statefulSet *appsv1.StatefulSet) (bool, error) {
+	log := ctrllog.FromContext(ctx)
+
+	volume := configVolume(statefulSet)
+	if volume == nil || volume.Secret != nil {
+		return false, nil
+	}
+	// Deleted first, so that it is not left behind if the deletion fails after the update
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "openldap-" + openldap.Name, Namespace: openldap.Namespace}}
+	log.Info("About to delete the ConfigMap of the previous version")
+	if err := r.Delete(ctx, configMap); err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	volume.VolumeSource = configVolumeSource(openldap)
+	log.Info("About to mount the configuration from the Secret")
+	if err := r.Update(ctx, statefulSet); err != nil {
+		r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "UpdateFailed", "Could not update StatefulSet %s: %s", statefulSet.Name, err)
+		return false, err
+	}
+	r.Recorder.Eventf(openldap, corev1.EventTypeNormal, "Updated", "StatefulSet %s mounts the configuration from Secret %s", statefulSet.Name, volume.Secret.SecretName)
+	return true, nil
+}
+
+// Executes a command in the pod, with the input in stdin. Returns its stdout and stderr
+func (r *OpenldapReconciler) execInPod(pod *corev1.Pod, command []string, input string) (string, string, error) {
+	req := r.RESTClient.Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: pod.Spec.Containers[0].Name,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+			TTY:       false,
+		}, runtime.NewParameterCodec(r.Scheme))
+
+	exec, err := remotecommand.NewSPDYExecutor(r.RESTConfig, "POST", req.URL())
+	if err != nil {
+		return "", "", err
+	}
+
+	in := strings.NewReader(input)
+	out := strings.Builder{}
+	eout := strings.Builder{}
+
+	// Connect this process' std{in,out,err} to the remote shell process.
+	err = exec.Stream(remotecommand.StreamOptions{
+		Stdin:  in,
+		Stdout: &out,
+		Stderr: &eout,
+		Tty:    false,
+	})
+	return out.String(), eout.String(), err
+}
+
+// Applies the configuration in the pod, executing the update script with the configuration in stdin. Returns
+// the last lines of the output of the script, which are also in the error
+func (r *OpenldapReconciler) updateConfigInPod(ctx context.Context, pod *corev1.Pod, config string) (string, error) {
+	log := ctrllog.FromContext(ctx)
+
+	out, eout, err := r.execInPod(pod, []string{"/ldifCompare/bin/updateLdapConfig.sh"}, config)
+	if err != nil {
+		// ldapmodify errors are in stderr. The script writes in stdout why it could not compare the configurations
+		summary := outputSummary(eout)
+		if summary == "" {
+			summary = outputSummary(out)
+		}
+		if summary != "" {
+			return summary, fmt.Errorf("%w: %s", err, summary)
+		}
+		return summary, err
+	}
+
+	// The output has the changes of the configuration, with its credentials if they are not redacted. Only the
+	// last lines are logged
+	log.Info("Update Command executed", "Pod", pod.Name)
+	log.V(1).Info("Update Command output", "Pod", pod.Name, "Stdout", outputSummary(out), "Stderr", outputSummary(eout))
+	// Same summary as for errors: stderr, or stdout if there is nothing in it
+	summary := outputSummary(eout)
+	if summary == "" {
+		summary = outputSummary(out)
+	}
+	return summary, nil
+}
+
+// Emits an event for the pods whose containers have restarted since the last time they were seen. The
+// first time a pod is seen, its restarts are only counted
+func (r *OpenldapReconciler) recordRestarts(openldap *openldapv1alpha1.Openldap, pods []corev1.Pod) {
+	r.restartsLock.Lock()
+	defer r.restartsLock.Unlock()
+	if r.restarts == nil {
+		r.restarts = make(map[types.NamespacedName]map[types.UID]int32)
+	}
+	key := types.NamespacedName{Namespace: openldap.Namespace, Name: openldap.Name}
+	seenRestarts := r.restarts[key]
+	r.restarts[key] = make(map[types.UID]int32)
+
+	for _, pod := range pods {
+		restarts := int32(0)
+		reason := ""
+		for _, container := range pod.Status.ContainerStatuses {
+			restarts += container.RestartCount
+			if terminated := container.LastTerminationState.Terminated; terminated != nil && reason == "" {
+				reason = fmt.Sprintf(". Last exit code %d: %s", terminated.ExitCode, terminated.Reason)
+			}
+		}
+		if seen, found := seenRestarts[pod.UID]; found && restarts > seen {
+			r.Recorder.Eventf(openldap, corev1.EventTypeWarning, "PodRestarted", "Pod %s restarted, %d restarts%s", pod.Name, restarts, reason)
+		}
+		r.restarts[key][pod.UID] = restarts
+	}
+}
+
+// Reads the credentials to bind to the providers from the secret, if there is one
+func (r *OpenldapReconciler) replicationCredentials(ctx context.Context, openldap *openldapv1alpha1.Openldap) (bindCredentials, error) {
+	name := openldap.Spec.Replication.CredentialsSecret
+	if name == "" {
+		return bindCredentials{}, nil
+	}
+	secret := &corev1.Secret{}
+	// Read from the API server, since only the metadata of the secrets is cached
+	if err := r.APIReader.Get(ctx, types.NamespacedName{Name: name, Namespace: openldap.Namespace}, secret); err != nil {
+		return bindCredentials{}, err
+	}
+	credentials := bindCredentials{dn: string(secret.Data["binddn"]), password: string(secret.Data["password"])}
+	if credentials.dn == "" || credentials.password == "" {
+		return bindCredentials{}, fmt.Errorf("the secret %s needs the binddn and password keys", name)
+	}
+	return credentials, nil
+}
+
+// Compares the contextCSN of each consumer pod with the one of the provider. Both are read from the pod,
+// since the provider may be in another cluster
+func (r *OpenldapReconciler) replicationStatus(ctx context.Context, openldap *openldapv1alpha1.Openldap, pods []corev1.Pod, credentials bindCredentials) *openldapv1alpha1.ReplicationStatus {
+	log := ctrllog.FromContext(ctx)
+
+	status := &openldapv1alpha1.ReplicationStatus{LastCheck: metav1.Now()}
+	database, err := replicatedDatabase(openldap)
+	if err != nil {
+		return status
+	}
+	url, err := providerURL(openldap)
+	if err != nil {
+		return status
+	}
+	if credentials.dn == "" {
+		credentials = bindCredentials{dn: database.rootDN, password: database.rootPW}
+	}
+
+	// ldapsearch reads the password from stdin, so that it is not in the arguments of any process
+	script := `ldapsearch -LLL -Q -o ldif-wrap=no -H ldapi:/// -Y EXTERNAL -b "$1" -s base contextCSN </dev/null && echo "# provider" && ` +
+		`ldapsearch -LLL -o ldif-wrap=no -H "$2" -x -D "$3" -y /dev/stdin -b "$1" -s base contextCSN`
+	for i := range pods {
+		node := openldapv1alpha1.NodeReplicationStatus{Name: pods[i].Name}
+		if pods[i].Status.Phase != corev1.PodRunning {
+			node.Error = "the pod is " + string(pods[i].Status.Phase)
+			status.Nodes = append(status.Nodes, node)
+			continue
+		}
+		out, eout, err := r.execInPod(&pods[i], []string{"/bin/sh", "-c", script, "sh", database.suffix, url, credentials.dn}, credentials.password)
+		if err != nil {
+			log.Error(err, "Could not read the contextCSN", "Pod", pods[i].Name)
+			node.Error = strings.TrimSpace(err.Error() + " " + eout)
+			status.Nodes = append(status.Nodes, node)
+			continue
+		}
+
+		var provider []string
+		current := &node.ContextCSN
+		for _, line := range strings.Split(out, "\n") {
+			if line == "# provider" {
+				current = &provider
+			} else if strings.HasPrefix(line, "contextCSN: ") {
+				*current = append(*current, strings.TrimPrefix(line, "contextCSN: "))
+			}
+		}
+		sort.Strings(node.ContextCSN)
+		sort.Strings(provider)
+		status.ProviderContextCSN = provider
+
+		lag, err := replicationLag(provider, node.ContextCSN)
+		if err != nil {
+			node.Error = err.Error()
+		}
+		node.Lag = metav1.Duration{Duration: lag}
+		if lag > status.Lag.Duration {
+			status.Lag = node.Lag
+		}
+		status.Nodes = append(status.Nodes, node)
+	}
+	return status
+}
+
+// Creates the StatefulSet with the ldap pods. Each pod has its own PVC, created from the volume claim template
+func (r *OpenldapReconciler) statefulSetForOpenldap(openldap *openldapv1alpha1.Openldap) *appsv1.StatefulSet {
+	replicas := replicasForOpenldap(openldap)
+	statefulSet := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "openldap-" + openldap.Name,
 			Namespace: openldap.Namespace,
-			Labels:    map[string]string{"app": "openldap", "openldap": openldap.Name},
+			Labels:    labelsForOpenldap(openldap),
 		},
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{{
-				Name:  "openldap-" + openldap.Name,
-				Image: openldap.Spec.Image,
-				Command: []string{
-					"/bin/sh",
-					"-c",
-					"slaptest -n 0 -f /usr/local/etc/openldap/slapd.conf -F /usr/local/etc/openldap/slapd.d && /usr/local/libexec/slapd -F /usr/local/etc/openldap/slapd.d -h \"ldap:/// ldapi:///\" -d stats",
-				},
-				VolumeMounts: []corev1.VolumeMount{
-					{
-						Name:      "ldap-database-volume",
-						MountPath: "/usr/local/var/openldap-data",
-					},
-					{
-						Name:      "ldap-config",
-						MountPath: "/usr/local/etc/openldap/slapd.conf",
-						SubPath:   "slapd.conf",
-					},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: headlessServiceName(openldap),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labelsForOpenldap(openldap),
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labelsForOpenldap(openldap),
 				},
-			}},
-			Volumes: []corev1.Volume{
-				{
-					Name: "ldap-database-volume",
-					VolumeSource: corev1.VolumeSource{
-						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-							ClaimName: "openldap-" + openldap.Name,
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:    "openldap-" + openldap.Name,
+						Image:   openldap.Spec.Image,
+						Command: slapdCommand(openldap),
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      "ldap-database-volume",
+								MountPath: "/usr/local/var/openldap-data",
+							},
+							{
+								Name:      "ldap-config",
+								MountPath: "/usr/local/etc/openldap/slapd.conf",
+								SubPath:   "slapd.conf",
+							},
+						},
+					}},
+					Volumes: []corev1.Volume{
+						{
+							Name:         "ldap-config",
+							VolumeSource: configVolumeSource(openldap),
 						},
 					},
 				},
-				{
-					Name: "ldap-config",
-					VolumeSource: corev1.VolumeSource{
-						ConfigMap: &corev1.ConfigMapVolumeSource{
-							LocalObjectReference: corev1.LocalObjectReference{
-								Name: "openldap-" + openldap.Name,
-							},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ldap-database-volume",
+					Labels: labelsForOpenldap(openldap),
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							"storage": openldap.Spec.StorageSize,
 						},
 					},
 				},
-			},
+			}},
 		},
 	}
-	ctrl.SetControllerReference(openldap, pod, r.Scheme)
-	return pod
+	ctrl.SetControllerReference(openldap, statefulSet, r.Scheme)
+	return statefulSet
 }
 
-// Creates the PVC
-func (r *OpenldapReconciler) pvcForOpenLdap(openldap *openldapv1alpha1.Openldap) *corev1.PersistentVolumeClaim {
-	pvc := &corev1.PersistentVolumeClaim{
+// Command of the pods. slapd listens on the URL of the instance, which is in /etc/hosts, as in its serverID and
+// in the syncrepl to it. It also listens in localhost and ldapi, for port forwarding and the update script
+func slapdCommand(openldap *openldapv1alpha1.Openldap) []string {
+	listeners := hostURL(openldap, "$(hostname)") + " ldap://127.0.0.1:389 ldapi:///"
+	return []string{
+		"/bin/sh",
+		"-c",
+		"slaptest -n 0 -f /usr/local/etc/openldap/slapd.conf -F /usr/local/etc/openldap/slapd.d && /usr/local/libexec/slapd -F /usr/local/etc/openldap/slapd.d -h \"" + listeners + "\" -d stats",
+	}
+}
+
+// Creates the headless service, which gives each pod a DNS name: openldap-<name>-<n>.openldap-<name>-headless
+func (r *OpenldapReconciler) headlessServiceForOpenldap(openldap *openldapv1alpha1.Openldap) *corev1.Service {
+	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "openldap-" + openldap.Name,
+			Name:      headlessServiceName(openldap),
 			Namespace: openldap.Namespace,
 		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					"storage": openldap.Spec.StorageSize,
-				},
-			},
+		Spec: corev1.ServiceSpec{
+			Selector:  labelsForOpenldap(openldap),
+			ClusterIP: corev1.ClusterIPNone,
+			Ports: []corev1.ServicePort{{
+				Name:     "ldap",
+				Protocol: "TCP",
+				Port:     389,
+			}},
+			// Replicas find each other before they are ready
+			PublishNotReadyAddresses: true,
 		},
 	}
+	ctrl.SetControllerReference(openldap, service, r.Scheme)
+	return service
+}
 
-	// Mark for deletion when main object is erased if so specified
-	if openldap.Spec.DisposePVC {
-		ctrl.SetControllerReference(openldap, pvc, r.Scheme)
+// Label of the pods of a StatefulSet with their name
+const podNameLabel = "statefulset.kubernetes.io/pod-name"
+
+// Pods of the load balancer service. In mirror mode, writes must go to a single instance, so only one pod gets the
+// traffic: the one in the current selector while it is ready, and otherwise the first ready pod. When none is
+// ready, the selector is kept, or it is the first pod for a new service
+func serviceSelector(openldap *openldapv1alpha1.Openldap, current map[string]string, pods []corev1.Pod) map[string]string {
+	if openldap.Spec.Role == openldapv1alpha1.RoleConsumer || openldap.Spec.Replication.Mode != openldapv1alpha1.ReplicationMirror {
+		return map[string]string{"openldap": openldap.Name}
 	}
 
-	return pvc
+	ready := make(map[string]bool)
+	for _, pod := range pods {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				ready[pod.Name] = true
+			}
+		}
+	}
+	writer := current[podNameLabel]
+	if !ready[writer] {
+		for i := replicasForOpenldap(openldap) - 1; i >= 0; i-- {
+			if ready[instanceHost(openldap, i)] {
+				writer = instanceHost(openldap, i)
+			}
+		}
+	}
+	if writer == "" {
+		writer = instanceHost(openldap, 0)
+	}
+	return map[string]string{"openldap": openldap.Name, podNameLabel: writer}
 }
 
 // Creates the load balancer service
-func (r *OpenldapReconciler) serviceForOpenldap(openldap *openldapv1alpha1.Openldap) *corev1.Service {
-	labels := map[string]string{"openldap": openldap.Name}
+func (r *OpenldapReconciler) serviceForOpenldap(openldap *openldapv1alpha1.Openldap, pods []corev1.Pod) *corev1.Service {
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "openldap-" + openldap.Name,
 			Namespace: openldap.Namespace,
 		},
 		Spec: corev1.ServiceSpec{
-			Selector: labels,
+			Selector: serviceSelector(openldap, nil, pods),
 			Ports: []corev1.ServicePort{{
 				Name:     "ldap",
 				Protocol: "TCP",
@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1alpha1 "ldapOperator/api/v1alpha1"
+)
+
+// Reconciler with a fake client with the objects
+func testReconciler(t *testing.T, objects ...client.Object) (*OpenldapReconciler, *record.FakeRecorder) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := openldapv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	return &OpenldapReconciler{Client: fakeClient, Scheme: scheme, APIReader: fakeClient, Recorder: recorder}, recorder
+}
+
+func testOpenldap() *openldapv1alpha1.Openldap {
+	openldap := &openldapv1alpha1.Openldap{}
+	openldap.Name, openldap.Namespace, openldap.UID = "sample", "ns", "openldap-uid"
+	openldap.Spec.Image = "openldap:2.5"
+	openldap.Spec.StorageSize = resource.MustParse("1Gi")
+	openldap.Spec.Config = testConfig
+	return openldap
+}
+
+// Pod with the labels of the Openldap, controlled by the owner
+func testPod(name string, openldap string, owner metav1.OwnerReference) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Name, pod.Namespace = name, "ns"
+	pod.Labels = map[string]string{"app": "openldap", "openldap": openldap}
+	controller := true
+	owner.Controller = &controller
+	pod.OwnerReferences = []metav1.OwnerReference{owner}
+	return pod
+}
+
+func TestStatefulSetForOpenldap(t *testing.T) {
+	r, _ := testReconciler(t)
+	openldap := testOpenldap()
+	statefulSet := r.statefulSetForOpenldap(openldap)
+
+	// Objects created before replicas existed have 0, which is a single pod
+	if statefulSet.Name != "openldap-sample" || statefulSet.Namespace != "ns" || *statefulSet.Spec.Replicas != 1 {
+		t.Errorf("Bad StatefulSet %s/%s with %d replicas", statefulSet.Namespace, statefulSet.Name, *statefulSet.Spec.Replicas)
+	}
+	if statefulSet.Spec.ServiceName != "openldap-sample-headless" || statefulSet.Spec.Selector.MatchLabels["openldap"] != "sample" ||
+		statefulSet.Spec.Template.Labels["openldap"] != "sample" {
+		t.Errorf("Bad service or labels: %+v", statefulSet.Spec)
+	}
+	if owner := metav1.GetControllerOf(statefulSet); owner == nil || owner.UID != openldap.UID {
+		t.Errorf("Bad owner %v", owner)
+	}
+
+	container := statefulSet.Spec.Template.Spec.Containers[0]
+	if container.Image != "openldap:2.5" || !strings.Contains(container.Command[2], "slaptest -n 0 -f /usr/local/etc/openldap/slapd.conf") {
+		t.Errorf("Bad container %+v", container)
+	}
+	mounts := map[string]corev1.VolumeMount{}
+	for _, mount := range container.VolumeMounts {
+		mounts[mount.Name] = mount
+	}
+	if mounts["ldap-database-volume"].MountPath != "/usr/local/var/openldap-data" || mounts["ldap-config"].SubPath != "slapd.conf" {
+		t.Errorf("Bad mounts %+v", container.VolumeMounts)
+	}
+
+	// The configuration is mounted from the secret, since it has the replication credentials
+	if volume := configVolume(statefulSet); volume == nil || volume.Secret == nil || volume.Secret.SecretName != "openldap-sample" {
+		t.Errorf("Bad configuration volume %+v", volume)
+	}
+	claim := statefulSet.Spec.VolumeClaimTemplates[0]
+	if size := claim.Spec.Resources.Requests["storage"]; claim.Name != "ldap-database-volume" || size.Cmp(resource.MustParse("1Gi")) != 0 {
+		t.Errorf("Bad volume claim template %+v", claim)
+	}
+
+	openldap.Spec.Replicas = 3
+	if replicas := *r.statefulSetForOpenldap(openldap).Spec.Replicas; replicas != 3 {
+		t.Errorf("Bad replicas %d", replicas)
+	}
+}
+
+func TestPodsForOpenldap(t *testing.T) {
+	openldap := testOpenldap()
+	statefulSet := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "openldap-sample", UID: "sts-uid"}
+	r, _ := testReconciler(t,
+		testPod("openldap-sample-0", "sample", statefulSet),
+		testPod("openldap-sample-1", "sample", statefulSet),
+		// Pod of the previous version, with the same labels
+		testPod("openldap-sample", "sample", metav1.OwnerReference{APIVersion: "openldap.minsait.com/v1alpha1", Kind: "Openldap", Name: "sample", UID: openldap.UID}),
+		testPod("openldap-other-0", "other", metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "openldap-other", UID: "other-uid"}),
+	)
+
+	podList, err := r.podsForOpenldap(context.Background(), openldap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, pod := range podList.Items {
+		names = append(names, pod.Name)
+	}
+	if strings.Join(names, " ") != "openldap-sample-0 openldap-sample-1" {
+		t.Errorf("Bad pods %v", names)
+	}
+}
+
+func TestRemoveLegacyPod(t *testing.T) {
+	openldap := testOpenldap()
+	legacyPVC := &corev1.PersistentVolumeClaim{}
+	legacyPVC.Name, legacyPVC.Namespace = "openldap-sample", "ns"
+	r, recorder := testReconciler(t,
+		testPod("openldap-sample", "sample", metav1.OwnerReference{APIVersion: "openldap.minsait.com/v1alpha1", Kind: "Openldap", Name: "sample", UID: openldap.UID}),
+		legacyPVC,
+	)
+
+	if err := r.removeLegacyPod(context.Background(), openldap); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "openldap-sample", Namespace: "ns"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Errorf("The pod of the previous version was not deleted: %v", err)
+	}
+	// The PVC is kept, with its data
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "openldap-sample", Namespace: "ns"}, &corev1.PersistentVolumeClaim{}); err != nil {
+		t.Errorf("The PVC of the previous version was deleted: %v", err)
+	}
+	if events := strings.Join([]string{<-recorder.Events, <-recorder.Events}, "\n"); !strings.Contains(events, "Normal Deleted") || !strings.Contains(events, "Warning LegacyPVC") {
+		t.Errorf("Bad events %s", events)
+	}
+
+	// Pods with the same name that the Openldap does not control are kept
+	r, _ = testReconciler(t, testPod("openldap-sample", "sample", metav1.OwnerReference{APIVersion: "v1", Kind: "ReplicationController", Name: "other", UID: "other-uid"}))
+	if err := r.removeLegacyPod(context.Background(), openldap); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "openldap-sample", Namespace: "ns"}, &corev1.Pod{}); err != nil {
+		t.Errorf("Pod not controlled by the Openldap deleted: %v", err)
+	}
+}
+
+func TestMigrateConfigVolume(t *testing.T) {
+	openldap := testOpenldap()
+	r, _ := testReconciler(t)
+	statefulSet := r.statefulSetForOpenldap(openldap)
+	configVolume(statefulSet).VolumeSource = corev1.VolumeSource{
+		ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "openldap-sample"}},
+	}
+	configMap := &corev1.ConfigMap{}
+	configMap.Name, configMap.Namespace = "openldap-sample", "ns"
+	r, _ = testReconciler(t, statefulSet, configMap)
+
+	existing := &appsv1.StatefulSet{}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "openldap-sample", Namespace: "ns"}, existing); err != nil {
+		t.Fatal(err)
+	}
+	if migrated, err := r.migrateConfigVolume(context.Background(), openldap, existing); err != nil || !migrated {
+		t.Fatalf("StatefulSet not migrated: %v", err)
+	}
+
+	existing = &appsv1.StatefulSet{}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "openldap-sample", Namespace: "ns"}, existing); err != nil {
+		t.Fatal(err)
+	}
+	if volume := configVolume(existing); volume.ConfigMap != nil || volume.Secret == nil || volume.Secret.SecretName != "openldap-sample" {
+		t.Errorf("Bad configuration volume %+v", volume)
+	}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "openldap-sample", Namespace: "ns"}, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("The ConfigMap of the previous version was not deleted: %v", err)
+	}
+
+	// Only once
+	if migrated, err := r.migrateConfigVolume(context.Background(), openldap, existing); err != nil || migrated {
+		t.Errorf("StatefulSet migrated again: %v", err)
+	}
+}
+
+func TestServiceSelector(t *testing.T) {
+	pods := func(ready ...bool) []corev1.Pod {
+		var list []corev1.Pod
+		for i, isReady := range ready {
+			pod := corev1.Pod{}
+			pod.Name = fmt.Sprintf("openldap-sample-%d", i)
+			status := corev1.ConditionFalse
+			if isReady {
+				status = corev1.ConditionTrue
+			}
+			pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+			list = append(list, pod)
+		}
+		return list
+	}
+	for _, test := range []struct {
+		name    string
+		mode    openldapv1alpha1.ReplicationMode
+		current string
+		pods    []corev1.Pod
+		writer  string
+	}{
+		{"all pods without mirror", openldapv1alpha1.ReplicationMultiProvider, "", pods(true, true), ""},
+		{"new service", openldapv1alpha1.ReplicationMirror, "", nil, "openldap-sample-0"},
+		{"first ready pod", openldapv1alpha1.ReplicationMirror, "", pods(false, true, true), "openldap-sample-1"},
+		{"writer ready", openldapv1alpha1.ReplicationMirror, "openldap-sample-2", pods(true, true, true), "openldap-sample-2"},
+		{"writer not ready", openldapv1alpha1.ReplicationMirror, "openldap-sample-0", pods(false, false, true), "openldap-sample-2"},
+		{"none ready", openldapv1alpha1.ReplicationMirror, "openldap-sample-1", pods(false, false, false), "openldap-sample-1"},
+	} {
+		openldap := testOpenldap()
+		openldap.Spec.Replicas = 3
+		openldap.Spec.Replication.Mode = test.mode
+		current := map[string]string{"openldap": "sample"}
+		if test.current != "" {
+			current[podNameLabel] = test.current
+		}
+
+		selector := serviceSelector(openldap, current, test.pods)
+		if selector["openldap"] != "sample" || selector[podNameLabel] != test.writer || test.writer == "" && len(selector) != 1 {
+			t.Errorf("%s: bad selector %v", test.name, selector)
+		}
+	}
+}
+
+func TestOpenldapsForSecret(t *testing.T) {
+	withCredentials, other := testOpenldap(), testOpenldap()
+	withCredentials.Spec.Replication.CredentialsSecret = "replication"
+	other.Name, other.UID = "other", "other-uid"
+	r, _ := testReconciler(t, withCredentials, other)
+
+	secret := &metav1.PartialObjectMetadata{}
+	secret.Name, secret.Namespace = "replication", "ns"
+	requests := r.openldapsForSecret(secret)
+	if len(requests) != 1 || requests[0].Name != "sample" || requests[0].Namespace != "ns" {
+		t.Errorf("Bad requests %v", requests)
+	}
+
+	secret.Name = "openldap-other"
+	if requests := r.openldapsForSecret(secret); len(requests) != 0 {
+		t.Errorf("Unexpected requests %v", requests)
+	}
+}
@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	openldapv1alpha1 "ldapOperator/api/v1alpha1"
+)
+
+// Rendering of the slapd.conf of the pods. With replication, the serverID, syncrepl and syncprov
+// directives are added to the configuration of the custom resource. All the pods share the same
+// configuration: each one finds its serverID by the URL it listens on, and ignores the syncrepl to itself.
+// Consumers get a syncrepl to their provider
+
+// Returns the keyword, in lower case, and the value of a directive line. Empty for comments, blank
+// lines and continuation lines
+func confDirective(line string) (string, string) {
+	if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+		return "", ""
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return strings.ToLower(fields[0]), value
+}
+
+// Quotes a value for slapd.conf
+func confQuote(value string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), `"`, `\"`) + `"`
+}
+
+// Host name of the pod of an instance, as returned by hostname
+func instanceHost(openldap *openldapv1alpha1.Openldap, instance int32) string {
+	return fmt.Sprintf("openldap-%s-%d", openldap.Name, instance)
+}
+
+// URL of an instance, through the headless service. It is used in its serverID and in the syncrepl to it, and
+// slapd listens on it, so that each instance finds its serverID and skips the syncrepl to itself
+func instanceURL(openldap *openldapv1alpha1.Openldap, instance int32) string {
+	return hostURL(openldap, instanceHost(openldap, instance))
+}
+
+// URL of a host name of the headless service
+func hostURL(openldap *openldapv1alpha1.Openldap, host string) string {
+	domain := openldap.Spec.Replication.ClusterDomain
+	if domain == "" {
+		domain = "cluster.local"
+	}
+	return fmt.Sprintf("ldap://%s.%s.%s.svc.%s:389", host, headlessServiceName(openldap), openldap.Namespace, domain)
+}
+
+// Credentials to bind to the providers. Empty to use the rootdn and rootpw of the database
+type bindCredentials struct {
+	dn       string
+	password string
+}
+
+// A database of slapd.conf, from its database line to the next one
+type confDatabase struct {
+	start, end             int
+	suffix, rootDN, rootPW string
+	// Line after the last suffix, rootdn or rootpw, and last line with a directive
+	afterRoot, lastDirective int
+	hasSyncprov              bool
+}
+
+// Finds the database with the suffix or, if suffix is empty, the first database with a suffix. Nil if there is none
+func findDatabase(lines []string, suffix string) *confDatabase {
+	var database *confDatabase
+	current := -1
+	for i, line := range lines {
+		keyword, value := confDirective(line)
+		if keyword == "database" {
+			if database != nil {
+				database.end = i
+				break
+			}
+			current = i
+		}
+		if keyword == "suffix" && database == nil && current >= 0 && (suffix == "" || strings.EqualFold(value, suffix)) {
+			database = &confDatabase{start: current, end: len(lines), suffix: value, afterRoot: -1, lastDirective: -1}
+		}
+	}
+	if database == nil {
+		return nil
+	}
+
+	for i := database.start + 1; i < database.end; i++ {
+		keyword, value := confDirective(lines[i])
+		switch keyword {
+		case "suffix", "rootdn", "rootpw":
+			database.afterRoot = i + 1
+			if keyword == "rootdn" {
+				database.rootDN = value
+			} else if keyword == "rootpw" {
+				database.rootPW = value
+			}
+		case "overlay":
+			database.hasSyncprov = database.hasSyncprov || value == "syncprov"
+		}
+		if trimmed := strings.TrimSpace(lines[i]); trimmed != "" && trimmed[0] != '#' {
+			database.lastDirective = i
+		}
+	}
+	return database
+}
+
+// Finds the replicated database in the configuration of the custom resource
+func replicatedDatabase(openldap *openldapv1alpha1.Openldap) (*confDatabase, error) {
+	suffix := openldap.Spec.Replication.Suffix
+	database := findDatabase(strings.Split(openldap.Spec.Config, "\n"), suffix)
+	switch {
+	case database == nil && suffix != "":
+		return nil, fmt.Errorf("there is no database with suffix %s in the configuration", suffix)
+	case database == nil:
+		return nil, fmt.Errorf("there is no database with a suffix in the configuration")
+	}
+	return database, nil
+}
+
+// URL of the provider of a consumer: its load balancer service, or the URL in the reference
+func providerURL(openldap *openldapv1alpha1.Openldap) (string, error) {
+	ref := openldap.Spec.ProviderRef
+	if ref == nil || (ref.Name == "" && ref.URL == "") {
+		return "", fmt.Errorf("consumers need the name or the URL of the provider in providerRef")
+	}
+	if ref.URL != "" {
+		return ref.URL, nil
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = openldap.Namespace
+	}
+	domain := openldap.Spec.Replication.ClusterDomain
+	if domain == "" {
+		domain = "cluster.local"
+	}
+	return fmt.Sprintf("ldap://openldap-%s.%s.svc.%s:389", ref.Name, namespace, domain), nil
+}
+
+// Renders the configuration of the pods: Spec.Config, with the replication directives for consumers and
+// for providers with replication
+func renderConfig(openldap *openldapv1alpha1.Openldap, credentials bindCredentials) (string, error) {
+	consumer := openldap.Spec.Role == openldapv1alpha1.RoleConsumer
+	mode := openldap.Spec.Replication.Mode
+	if !consumer && (mode == "" || mode == openldapv1alpha1.ReplicationNone) {
+		return openldap.Spec.Config, nil
+	}
+
+	lines := strings.Split(openldap.Spec.Config, "\n")
+	database, err := replicatedDatabase(openldap)
+	if err != nil {
+		return "", err
+	}
+	if credentials.dn == "" {
+		switch {
+		case database.rootDN == "" || database.rootPW == "":
+			return "", fmt.Errorf("the database %s needs rootdn and rootpw for the replication, or a credentials secret", database.suffix)
+		case strings.HasPrefix(database.rootPW, "{"):
+			return "", fmt.Errorf("the rootpw of the database %s is hashed. The replication needs it in clear text, or a credentials secret", database.suffix)
+		}
+		credentials = bindCredentials{dn: database.rootDN, password: database.rootPW}
+	}
+	syncrepl := func(rid int32, url string) string {
+		return fmt.Sprintf("syncrepl rid=%03d provider=%s bindmethod=simple binddn=%s credentials=%s searchbase=%s type=refreshAndPersist retry=\"5 5 300 +\" timeout=1",
+			rid, url, confQuote(credentials.dn), confQuote(credentials.password), confQuote(database.suffix))
+	}
+
+	var serverIDs []string
+	syncrepls := []string{"# Replication, added by the operator"}
+	if consumer {
+		// Consumers replicate from the provider, and send the clients that write to it
+		url, err := providerURL(openldap)
+		if err != nil {
+			return "", err
+		}
+		syncrepls = append(syncrepls, syncrepl(1, url), "updateref "+url)
+	} else {
+		// Each instance is identified by its hostname. The syncrepl stanzas are the same in all of them
+		serverIDs = []string{"# Replication, added by the operator"}
+		replicas := replicasForOpenldap(openldap)
+		for i := int32(0); i < replicas; i++ {
+			serverIDs = append(serverIDs, fmt.Sprintf("serverID %d %s", i+1, instanceURL(openldap, i)))
+			syncrepls = append(syncrepls, syncrepl(i+1, instanceURL(openldap, i)))
+		}
+		serverIDs = append(serverIDs, "")
+		if mode == openldapv1alpha1.ReplicationMirror {
+			syncrepls = append(syncrepls, "mirrormode on")
+		} else {
+			syncrepls = append(syncrepls, "multiprovider on")
+		}
+	}
+
+	firstDatabase := -1
+	for i, line := range lines {
+		if keyword, _ := confDirective(line); keyword == "database" {
+			firstDatabase = i
+			break
+		}
+	}
+
+	var rendered []string
+	for i, line := range lines {
+		if i == firstDatabase {
+			rendered = append(rendered, serverIDs...)
+		}
+		rendered = append(rendered, line)
+		// syncrepl needs the suffix and the rootdn
+		if i == database.afterRoot-1 {
+			rendered = append(rendered, syncrepls...)
+		}
+		if i == database.lastDirective && !consumer && !database.hasSyncprov {
+			rendered = append(rendered, "overlay syncprov", "syncprov-checkpoint 100 10", "syncprov-sessionlog 100")
+		}
+	}
+	return strings.Join(rendered, "\n"), nil
+}
+
+// Parses the timestamp and the serverID of a CSN, such as 20210601120000.123456Z#000000#001#000000
+func parseCSN(csn string) (time.Time, string, error) {
+	parts := strings.Split(csn, "#")
+	if len(parts) != 4 {
+		return time.Time{}, "", fmt.Errorf("invalid CSN %s", csn)
+	}
+	timestamp, err := time.Parse("20060102150405.000000Z", parts[0])
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid CSN %s: %w", csn, err)
+	}
+	return timestamp, parts[2], nil
+}
+
+// Returns how far behind the contextCSN of a consumer are from the ones of the provider: the largest
+// difference between their timestamps for the same serverID
+func replicationLag(provider []string, consumer []string) (time.Duration, error) {
+	replicated := make(map[string]time.Time)
+	for _, csn := range consumer {
+		timestamp, sid, err := parseCSN(csn)
+		if err != nil {
+			return 0, err
+		}
+		replicated[sid] = timestamp
+	}
+
+	var lag time.Duration
+	for _, csn := range provider {
+		timestamp, sid, err := parseCSN(csn)
+		if err != nil {
+			return 0, err
+		}
+		consumerTimestamp, found := replicated[sid]
+		if !found {
+			return 0, fmt.Errorf("nothing replicated yet from serverID %s", sid)
+		}
+		if difference := timestamp.Sub(consumerTimestamp); difference > lag {
+			lag = difference
+		}
+	}
+	return lag, nil
+}
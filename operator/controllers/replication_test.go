@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	openldapv1alpha1 "ldapOperator/api/v1alpha1"
+)
+
+const testConfig = `include /usr/local/etc/openldap/schema/core.schema
+pidfile /usr/local/var/run/slapd.pid
+
+database config
+rootdn "cn=admin,cn=config"
+rootpw secretcr
+
+database	mdb
+suffix		"dc=minsait,dc=com"
+rootdn		"cn=Manager,dc=minsait,dc=com"
+rootpw		secret
+directory	/usr/local/var/openldap-data
+index	objectClass	eq
+
+# Second database
+database	mdb
+suffix		"dc=other,dc=com"
+rootdn		"cn=Manager,dc=other,dc=com"
+rootpw		{SSHA}hashed
+overlay syncprov
+
+database monitor`
+
+func TestConfDirective(t *testing.T) {
+	for _, test := range []struct {
+		line    string
+		keyword string
+		value   string
+	}{
+		{`suffix		"dc=minsait,dc=com"`, "suffix", "dc=minsait,dc=com"},
+		{`RootDN cn=Manager`, "rootdn", "cn=Manager"},
+		{`access to * by "cn=x" read`, "access", `to * by "cn=x" read`},
+		{`database`, "database", ""},
+		{`# suffix "dc=minsait,dc=com"`, "", ""},
+		{`	by * read`, "", ""},
+		{``, "", ""},
+	} {
+		keyword, value := confDirective(test.line)
+		if keyword != test.keyword || value != test.value {
+			t.Errorf("Bad directive for %q: %q %q", test.line, keyword, value)
+		}
+	}
+}
+
+func TestFindDatabase(t *testing.T) {
+	lines := strings.Split(testConfig, "\n")
+	for _, test := range []struct {
+		suffix      string
+		found       string
+		rootDN      string
+		hasSyncprov bool
+	}{
+		{"", "dc=minsait,dc=com", "cn=Manager,dc=minsait,dc=com", false},
+		{"DC=Other,dc=com", "dc=other,dc=com", "cn=Manager,dc=other,dc=com", true},
+		{"dc=missing", "", "", false},
+	} {
+		database := findDatabase(lines, test.suffix)
+		if test.found == "" {
+			if database != nil {
+				t.Errorf("Unexpected database for %s: %+v", test.suffix, database)
+			}
+			continue
+		}
+		if database == nil || database.suffix != test.found || database.rootDN != test.rootDN || database.hasSyncprov != test.hasSyncprov {
+			t.Errorf("Bad database for %q: %+v", test.suffix, database)
+			continue
+		}
+		if k, _ := confDirective(lines[database.start]); k != "database" || !strings.HasPrefix(lines[database.end], "#") && !strings.HasPrefix(lines[database.end], "database") {
+			t.Errorf("Bad limits for %q: %+v", test.suffix, database)
+		}
+	}
+}
+
+func TestRenderConfig(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		role        openldapv1alpha1.Role
+		mode        openldapv1alpha1.ReplicationMode
+		suffix      string
+		providerRef *openldapv1alpha1.ProviderRef
+		credentials bindCredentials
+		contains    []string
+		missing     []string
+		err         string
+	}{
+		{name: "no replication", mode: openldapv1alpha1.ReplicationNone, missing: []string{"serverID", "syncrepl"}},
+		{name: "mirror", mode: openldapv1alpha1.ReplicationMirror,
+			contains: []string{
+				"serverID 1 ldap://openldap-sample-0.openldap-sample-headless.ns.svc.cluster.local:389\n" +
+					"serverID 2 ldap://openldap-sample-1.openldap-sample-headless.ns.svc.cluster.local:389\n\ndatabase config",
+				`rootpw		secret` + "\n# Replication, added by the operator\nsyncrepl rid=001 provider=ldap://openldap-sample-0.openldap-sample-headless.ns.svc.cluster.local:389 " +
+					`bindmethod=simple binddn="cn=Manager,dc=minsait,dc=com" credentials="secret" searchbase="dc=minsait,dc=com"`,
+				"syncrepl rid=002 provider=ldap://openldap-sample-1.",
+				"mirrormode on\ndirectory",
+				"index	objectClass	eq\noverlay syncprov\nsyncprov-checkpoint 100 10\nsyncprov-sessionlog 100\n",
+			}},
+		{name: "multi-provider with credentials", mode: openldapv1alpha1.ReplicationMultiProvider, credentials: bindCredentials{"cn=repl", `pa"ss`},
+			contains: []string{`binddn="cn=repl" credentials="pa\"ss"`, "multiprovider on"},
+			missing:  []string{"mirrormode"}},
+		{name: "existing syncprov", mode: openldapv1alpha1.ReplicationMirror, suffix: "dc=other,dc=com", credentials: bindCredentials{"cn=repl", "pass"},
+			contains: []string{`searchbase="dc=other,dc=com"`},
+			missing:  []string{"syncprov-checkpoint"}},
+		{name: "hashed rootpw", mode: openldapv1alpha1.ReplicationMirror, suffix: "dc=other,dc=com", err: "is hashed"},
+		{name: "missing suffix", mode: openldapv1alpha1.ReplicationMirror, suffix: "dc=missing", err: "no database with suffix dc=missing"},
+		{name: "consumer", role: openldapv1alpha1.RoleConsumer, providerRef: &openldapv1alpha1.ProviderRef{Name: "main", Namespace: "prod"},
+			contains: []string{
+				"syncrepl rid=001 provider=ldap://openldap-main.prod.svc.cluster.local:389 ",
+				"updateref ldap://openldap-main.prod.svc.cluster.local:389\n",
+			},
+			missing: []string{"serverID", "syncprov-checkpoint", "mirrormode", "rid=002"}},
+		{name: "consumer with url", role: openldapv1alpha1.RoleConsumer, providerRef: &openldapv1alpha1.ProviderRef{Name: "main", URL: "ldap://ldap.example.com"},
+			contains: []string{"provider=ldap://ldap.example.com ", "updateref ldap://ldap.example.com\n"}},
+		{name: "consumer without provider", role: openldapv1alpha1.RoleConsumer, err: "providerRef"},
+	} {
+		openldap := &openldapv1alpha1.Openldap{}
+		openldap.Name, openldap.Namespace = "sample", "ns"
+		openldap.Spec.Config = testConfig
+		openldap.Spec.Replicas = 2
+		openldap.Spec.Role = test.role
+		openldap.Spec.ProviderRef = test.providerRef
+		openldap.Spec.Replication = openldapv1alpha1.ReplicationSpec{Mode: test.mode, Suffix: test.suffix}
+
+		config, err := renderConfig(openldap, test.credentials)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for _, part := range test.contains {
+			if !strings.Contains(config, part) {
+				t.Errorf("%s: missing %q in\n%s", test.name, part, config)
+			}
+		}
+		for _, part := range test.missing {
+			if strings.Contains(config, part) {
+				t.Errorf("%s: unexpected %q in\n%s", test.name, part, config)
+			}
+		}
+		// slapd finds its serverID and the syncrepl to itself by the URL it listens on, so all of them are the same
+		for i := int32(0); test.role != openldapv1alpha1.RoleConsumer && test.mode != openldapv1alpha1.ReplicationNone && i < openldap.Spec.Replicas; i++ {
+			url := instanceURL(openldap, i)
+			if !strings.Contains(config, fmt.Sprintf("serverID %d %s\n", i+1, url)) || !strings.Contains(config, fmt.Sprintf("rid=%03d provider=%s ", i+1, url)) {
+				t.Errorf("%s: serverID and syncrepl of instance %d not with %s in\n%s", test.name, i, url, config)
+			}
+			if command := slapdCommand(openldap)[2]; !strings.Contains(command, strings.Replace(url, instanceHost(openldap, i), "$(hostname)", 1)+" ") {
+				t.Errorf("%s: slapd does not listen on %s: %s", test.name, url, command)
+			}
+		}
+		if test.mode == openldapv1alpha1.ReplicationNone && config != testConfig {
+			t.Errorf("%s: configuration changed", test.name)
+		}
+	}
+}
+
+func TestReplicationLag(t *testing.T) {
+	if timestamp, sid, err := parseCSN("20210601120000.123456Z#000000#001#000000"); err != nil || sid != "001" ||
+		!timestamp.Equal(time.Date(2021, 6, 1, 12, 0, 0, 123456000, time.UTC)) {
+		t.Errorf("Bad CSN: %v %s %v", timestamp, sid, err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		provider []string
+		consumer []string
+		lag      time.Duration
+		err      string
+	}{
+		{"up to date", []string{"20210601120010.000000Z#000000#001#000000"}, []string{"20210601120010.000000Z#000000#001#000000"}, 0, ""},
+		{"largest of the serverIDs",
+			[]string{"20210601120010.000000Z#000000#001#000000", "20210601120000.000000Z#000000#002#000000"},
+			[]string{"20210601120005.500000Z#000000#001#000000", "20210601115900.000000Z#000000#002#000000"}, time.Minute, ""},
+		{"consumer ahead", []string{"20210601120000.000000Z#000000#001#000000"}, []string{"20210601120010.000000Z#000000#001#000000"}, 0, ""},
+		{"serverID not replicated", []string{"20210601120010.000000Z#000000#002#000000"}, []string{"20210601120010.000000Z#000000#001#000000"}, 0, "serverID 002"},
+		{"invalid CSN", []string{"20210601120010Z#001"}, nil, 0, "invalid CSN"},
+	} {
+		lag, err := replicationLag(test.provider, test.consumer)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil || lag != test.lag {
+			t.Errorf("%s: bad lag %v %v", test.name, lag, err)
+		}
+	}
+}
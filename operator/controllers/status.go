@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openldapv1alpha1 "ldapOperator/api/v1alpha1"
+)
+
+// Conditions and phase of the status of an Openldap. Reconcile sets the conditions at each step,
+// and the status is updated when it returns
+
+// Sets a condition of the status. Its transition time only changes when its status does
+func setCondition(openldap *openldapv1alpha1.Openldap, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&openldap.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: openldap.Generation,
+	})
+}
+
+// Hash of a configuration, to know whether it has been applied
+func configHash(config string) string {
+	sum := sha256.Sum256([]byte(config))
+	return hex.EncodeToString(sum[:])
+}
+
+// Summary of the output of a command: its last three lines
+func outputSummary(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 3 {
+		lines = lines[len(lines)-3:]
+	}
+	return strings.Join(lines, " / ")
+}
+
+// Sets Degraded and the phase from the other conditions, and updates the status if it has changed
+func (r *OpenldapReconciler) updateStatus(ctx context.Context, openldap *openldapv1alpha1.Openldap, original *openldapv1alpha1.OpenldapStatus) error {
+	status := &openldap.Status
+
+	// Failures that do not stop the Openldap
+	degraded := map[string]string{
+		openldapv1alpha1.ConditionConfigApplied: "ApplyFailed",
+		openldapv1alpha1.ConditionStorageReady:  "SizeMismatch",
+		openldapv1alpha1.ConditionReady:         "PartiallyReady",
+	}
+	var reasons, messages []string
+	for _, condition := range status.Conditions {
+		if condition.Status == metav1.ConditionFalse && degraded[condition.Type] == condition.Reason {
+			reasons = append(reasons, condition.Reason)
+			messages = append(messages, condition.Message)
+		}
+	}
+	if len(reasons) > 0 {
+		setCondition(openldap, openldapv1alpha1.ConditionDegraded, metav1.ConditionTrue, reasons[0], strings.Join(messages, "; "))
+	} else {
+		setCondition(openldap, openldapv1alpha1.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "")
+	}
+
+	configApplied := meta.FindStatusCondition(status.Conditions, openldapv1alpha1.ConditionConfigApplied)
+	switch {
+	case configApplied != nil && configApplied.Reason == "InvalidConfiguration":
+		status.Phase = openldapv1alpha1.PhaseFailed
+	case len(reasons) > 0:
+		status.Phase = openldapv1alpha1.PhaseDegraded
+	case meta.IsStatusConditionTrue(status.Conditions, openldapv1alpha1.ConditionReady):
+		status.Phase = openldapv1alpha1.PhaseReady
+	default:
+		status.Phase = openldapv1alpha1.PhasePending
+	}
+	status.ObservedGeneration = openldap.Generation
+
+	if reflect.DeepEqual(original, status) {
+		return nil
+	}
+	return r.Status().Update(ctx, openldap)
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	openldapv1alpha1 "ldapOperator/api/v1alpha1"
+)
+
+func TestOutputSummary(t *testing.T) {
+	for output, summary := range map[string]string{
+		"":                              "",
+		"one\n":                         "one",
+		"one\n\n  two  \nthree\nfour\n": "two / three / four",
+	} {
+		if result := outputSummary(output); result != summary {
+			t.Errorf("Bad summary of %q: %q", output, result)
+		}
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	openldap := testOpenldap()
+	openldap.Generation = 3
+	setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "PodsNotReady", "0 of 1 pods ready")
+	transition := metav1.NewTime(openldap.Status.Conditions[0].LastTransitionTime.Add(-10 * time.Second))
+	openldap.Status.Conditions[0].LastTransitionTime = transition
+
+	// The transition time only changes with the status
+	setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "PartiallyReady", "1 of 2 pods ready")
+	condition := meta.FindStatusCondition(openldap.Status.Conditions, openldapv1alpha1.ConditionReady)
+	if len(openldap.Status.Conditions) != 1 || condition.Reason != "PartiallyReady" || condition.ObservedGeneration != 3 || !condition.LastTransitionTime.Equal(&transition) {
+		t.Errorf("Bad condition %+v", condition)
+	}
+	setCondition(openldap, openldapv1alpha1.ConditionReady, metav1.ConditionTrue, "PodsReady", "2 of 2 pods ready")
+	if condition := meta.FindStatusCondition(openldap.Status.Conditions, openldapv1alpha1.ConditionReady); condition.LastTransitionTime.Equal(&transition) {
+		t.Errorf("Transition time not changed %+v", condition)
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	type condition struct {
+		conditionType string
+		status        metav1.ConditionStatus
+		reason        string
+	}
+	for _, test := range []struct {
+		name       string
+		conditions []condition
+		phase      openldapv1alpha1.Phase
+		degraded   string
+	}{
+		{"pending", []condition{{openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "PodsNotReady"}}, openldapv1alpha1.PhasePending, "AsExpected"},
+		{"ready", []condition{
+			{openldapv1alpha1.ConditionConfigApplied, metav1.ConditionTrue, "Applied"},
+			{openldapv1alpha1.ConditionReady, metav1.ConditionTrue, "PodsReady"},
+		}, openldapv1alpha1.PhaseReady, "AsExpected"},
+		{"degraded by the storage", []condition{
+			{openldapv1alpha1.ConditionStorageReady, metav1.ConditionFalse, "SizeMismatch"},
+			{openldapv1alpha1.ConditionReady, metav1.ConditionTrue, "PodsReady"},
+		}, openldapv1alpha1.PhaseDegraded, "SizeMismatch"},
+		{"degraded by the configuration", []condition{
+			{openldapv1alpha1.ConditionConfigApplied, metav1.ConditionFalse, "ApplyFailed"},
+			{openldapv1alpha1.ConditionReady, metav1.ConditionFalse, "PartiallyReady"},
+		}, openldapv1alpha1.PhaseDegraded, "ApplyFailed"},
+		{"failed", []condition{
+			{openldapv1alpha1.ConditionConfigApplied, metav1.ConditionFalse, "InvalidConfiguration"},
+			{openldapv1alpha1.ConditionReady, metav1.ConditionTrue, "PodsReady"},
+		}, openldapv1alpha1.PhaseFailed, "AsExpected"},
+	} {
+		openldap := testOpenldap()
+		openldap.Generation = 2
+		r, _ := testReconciler(t, openldap)
+		if err := r.Get(context.Background(), types.NamespacedName{Name: "sample", Namespace: "ns"}, openldap); err != nil {
+			t.Fatal(err)
+		}
+		original := openldap.Status.DeepCopy()
+		for _, c := range test.conditions {
+			setCondition(openldap, c.conditionType, c.status, c.reason, "")
+		}
+		if err := r.updateStatus(context.Background(), openldap, original); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		updated := &openldapv1alpha1.Openldap{}
+		if err := r.Get(context.Background(), types.NamespacedName{Name: "sample", Namespace: "ns"}, updated); err != nil {
+			t.Fatal(err)
+		}
+		degraded := meta.FindStatusCondition(updated.Status.Conditions, openldapv1alpha1.ConditionDegraded)
+		if updated.Status.Phase != test.phase || updated.Status.ObservedGeneration != 2 || degraded == nil || degraded.Reason != test.degraded ||
+			(degraded.Status == metav1.ConditionTrue) != (test.degraded != "AsExpected") {
+			t.Errorf("%s: bad status %+v", test.name, updated.Status)
+		}
+
+		// Nothing is written when nothing has changed
+		original, version := updated.Status.DeepCopy(), updated.ResourceVersion
+		for _, c := range test.conditions {
+			setCondition(updated, c.conditionType, c.status, c.reason, "")
+		}
+		if err := r.updateStatus(context.Background(), updated, original); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		again := &openldapv1alpha1.Openldap{}
+		if err := r.Get(context.Background(), types.NamespacedName{Name: "sample", Namespace: "ns"}, again); err != nil {
+			t.Fatal(err)
+		}
+		if again.ResourceVersion != version {
+			t.Errorf("%s: status updated without changes, version %s to %s", test.name, version, again.ResourceVersion)
+		}
+	}
+}
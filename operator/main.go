@@ -101,6 +101,8 @@ func main() {
 		Scheme:     mgr.GetScheme(),
 		RESTClient: restClient,
 		RESTConfig: mgr.GetConfig(),
+		APIReader:  mgr.GetAPIReader(),
+		Recorder:   mgr.GetEventRecorderFor("openldap-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "Unable to create controller", "controller", "Openldap")
 		os.Exit(1)